@@ -0,0 +1,50 @@
+package main
+
+import (
+	"earthpullr/internal/config"
+	"earthpullr/pkg/xmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"time"
+)
+
+func runAttribution(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("attribution", flag.ContinueOnError)
+	asJson := fs.Bool("json", false, "print the attribution as JSON")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: earthpullr attribution [-json] path/to/background...")
+	}
+	for _, fpath := range fs.Args() {
+		attribution, err := xmp.Read(fpath)
+		if err != nil {
+			return err
+		}
+		if *asJson {
+			out, err := json.Marshal(struct {
+				Path string `json:"path"`
+				xmp.Attribution
+			}{fpath, attribution})
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%s\n  Title:      %s\n  Author:     u/%s\n  Subreddit:  r/%s\n  Permalink:  %s\n  Downloaded: %s\n",
+			fpath,
+			attribution.Title,
+			attribution.Author,
+			attribution.Subreddit,
+			attribution.Permalink,
+			attribution.DownloadedAt.Local().Format(time.RFC1123),
+		)
+	}
+	return nil
+}
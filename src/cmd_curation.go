@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/internal/curation"
+	"earthpullr/internal/reddit_cli"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+)
+
+func runFavourite(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("favourite", flag.ContinueOnError)
+	remove := fs.Bool("remove", false, "remove the backgrounds from the favourites instead")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: earthpullr favourite [-remove] path/to/background...")
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	for _, fpath := range fs.Args() {
+		if *remove {
+			err = retriever.UnfavouriteBackground(fpath)
+		} else {
+			err = retriever.FavouriteBackground(fpath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runFavourites(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("favourites", flag.ContinueOnError)
+	output := fs.String("o", "", "file to export the favourites to, they are printed when not set")
+	format := fs.String("format", curation.ExportFormatText, "export format, one of 'text' or 'json'")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+		if err != nil {
+			return err
+		}
+		return retriever.ExportFavourites(*output, *format)
+	}
+	manager, err := curation.NewManager(conf.ApplicationName, conf.CurationFname)
+	if err != nil {
+		return err
+	}
+	return manager.ExportFavourites(os.Stdout, *format)
+}
+
+func runBan(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("ban", flag.ContinueOnError)
+	author := fs.String("author", "", "reddit user whose posts are never downloaded")
+	domain := fs.String("domain", "", "domain whose images are never downloaded, including its subdomains")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && *author == "" && *domain == "" {
+		return fmt.Errorf("usage: earthpullr ban [-author name] [-domain domain] [path/to/background...]")
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	if *author != "" {
+		if err = retriever.BanAuthor(*author); err != nil {
+			return err
+		}
+	}
+	if *domain != "" {
+		if err = retriever.BanDomain(*domain); err != nil {
+			return err
+		}
+	}
+	for _, fpath := range fs.Args() {
+		if err = retriever.BanBackground(fpath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
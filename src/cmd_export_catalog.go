@@ -0,0 +1,46 @@
+package main
+
+import (
+	"earthpullr/internal/catalog"
+	"earthpullr/internal/config"
+	"earthpullr/internal/user_settings"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"path/filepath"
+)
+
+func runExportCatalog(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("export-catalog", flag.ContinueOnError)
+	dir := fs.String("dir", "", "download directory to catalogue, defaults to the last used download path")
+	output := fs.String("o", "", "directory to write the catalogue to, defaults to a catalog directory within the download directory")
+	thumbnailWidth := fs.Int("thumbnail-width", 320, "width of the thumbnails in pixels")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		userSettingsMan, err := user_settings.NewUserSettingsManager(conf.ApplicationName, conf.UserSettingsFname)
+		if err != nil {
+			return err
+		}
+		*dir = userSettingsMan.Settings.DownloadPath
+		if *dir == "" {
+			return fmt.Errorf("no download path has been used yet, specify one with -dir")
+		}
+	}
+	if *output == "" {
+		*output = filepath.Join(*dir, "catalog")
+	}
+	count, err := catalog.Export(logger, catalog.Options{
+		DownloadPath:        *dir,
+		ExistingImagesFname: conf.ExistingImagesFilename,
+		OutputDir:           *output,
+		ThumbnailWidth:      *thumbnailWidth,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Catalogued %d backgrounds to %s\n", count, filepath.Join(*output, "index.html"))
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/internal/reddit_cli"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"strings"
+)
+
+func runFetch(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	dir := fs.String("dir", "", "download directory, defaults to the last used download path")
+	count := fs.Int("count", 0, "number of backgrounds to download, defaults to the last used count")
+	width := fs.Int("width", 0, "minimum width, defaults to the last used width")
+	height := fs.Int("height", 0, "minimum height, defaults to the last used height")
+	sources := fs.String("sources", "", "comma separated sources e.g. 'r/EarthPorn,r/SkyPorn', defaults to the last used sources")
+	dryRun := fs.Bool("dry-run", false, "list the backgrounds which would be downloaded without saving anything")
+	asJson := fs.Bool("json", false, "print the summary as JSON")
+	wait := fs.Bool("wait", false, "wait for another earthpullr using the download directory to finish instead of failing")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	request := retriever.DefaultBackgroundsRequest()
+	request.WaitForLock = *wait
+	request.DryRun = *dryRun
+	if *dir != "" {
+		request.DownloadPath = *dir
+	}
+	if *count != 0 {
+		request.BackgroundsCount = *count
+	}
+	if *width != 0 {
+		request.Width = *width
+	}
+	if *height != 0 {
+		request.Height = *height
+	}
+	if *sources != "" {
+		request.Sources = strings.Split(*sources, ",")
+	}
+	summary, err := retriever.FetchBackgrounds(request, nil)
+	if *asJson {
+		out, jsonErr := json.MarshalIndent(summary, "", "  ")
+		if jsonErr != nil {
+			return jsonErr
+		}
+		fmt.Println(string(out))
+		return err
+	}
+	for _, candidate := range summary.Candidates {
+		fmt.Printf("%dx%d\t%s\t%s\t%s\n", candidate.Width, candidate.Height, candidate.Source, candidate.Title, candidate.URL)
+	}
+	printRejections(summary.Rejections)
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "Found %d backgrounds which would be downloaded\n", len(summary.Candidates))
+	} else {
+		fmt.Fprintf(os.Stderr, "Downloaded %d backgrounds\n", summary.SavedImages)
+	}
+	return err
+}
+
+func printRejections(rejections map[string]int) {
+	var reasons []string
+	for reason := range rejections {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(os.Stderr, "Rejected %d as %s\n", rejections[reason], reason)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/internal/reddit_cli"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+)
+
+func runExport(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := fs.String("dir", "", "download directory whose index is exported, defaults to the last used download path")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: earthpullr export [-dir path/to/backgrounds] path/to/archive.zip")
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	return retriever.ExportLibrary(map[string]interface{}{
+		"ArchivePath":  fs.Arg(0),
+		"DownloadPath": *dir,
+	})
+}
+
+func runImport(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dir := fs.String("dir", "", "download directory to import into, defaults to the last used download path and then the exported one")
+	configOut := fs.String("config-out", "", "write the exported config to this file, it isn't imported when not set")
+	replaceSettings := fs.Bool("replace-settings", false, "replace the user settings with the exported ones instead of only filling in those not set")
+	wait := fs.Bool("wait", false, "wait for another earthpullr using the download directory to finish instead of failing")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: earthpullr import [-dir path/to/backgrounds] [-config-out config.json] [-replace-settings] path/to/archive.zip")
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	report, err := retriever.ImportLibrary(map[string]interface{}{
+		"ArchivePath":     fs.Arg(0),
+		"DownloadPath":    *dir,
+		"ConfigPath":      *configOut,
+		"ReplaceSettings": *replaceSettings,
+		"WaitForLock":     *wait,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Imported into %s, added %d backgrounds to the index (%d already present) and %d favourites and bans\n",
+		report.DownloadPath, report.AddedBackgrounds, report.DuplicateBackgrounds, report.AddedCuration)
+	if report.ConfigPath != "" {
+		fmt.Fprintf(os.Stderr, "Wrote the exported config to %s, use it with -config\n", report.ConfigPath)
+	}
+	if report.AddedBackgrounds > 0 {
+		fmt.Fprintf(os.Stderr, "Copy the backgrounds into %s, or run 'earthpullr verify -redownload' to download them again\n", report.DownloadPath)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/internal/reddit_cli"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+)
+
+func runLogin(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	scopes := fs.String("scopes", strings.Join(conf.RedditOAuthScopes, ","), "comma separated reddit oauth scopes to request")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Opening reddit in your browser, approve access to continue")
+	username, err := retriever.Login(strings.Split(*scopes, ","))
+	if err != nil {
+		return err
+	}
+	if username != "" {
+		fmt.Printf("Logged in as %s\n", username)
+	} else {
+		fmt.Println("Logged in")
+	}
+	return nil
+}
+
+func runLogout(args []string, conf config.Config, logger *zap.Logger) error {
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	return retriever.Logout()
+}
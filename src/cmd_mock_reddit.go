@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/pkg/mock_reddit"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func runMockReddit(args []string, conf config.Config, logger *zap.Logger) error {
+	var faults mock_reddit.Faults
+	fs := flag.NewFlagSet("mock-reddit", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8089", "address to listen on")
+	fixtureDir := fs.String("fixtures", "", "directory of images to serve, subdirectories named after subreddits are served for that subreddit only")
+	fs.IntVar(&faults.RateLimitEvery, "rate-limit-every", 0, "respond 429 to every Nth request")
+	fs.IntVar(&faults.RetryAfterSecs, "retry-after-secs", 1, "Retry-After header value sent with 429 responses")
+	fs.IntVar(&faults.ServerErrorEvery, "server-error-every", 0, "respond 500 to every Nth request")
+	fs.IntVar(&faults.MalformedJSONEvery, "malformed-json-every", 0, "respond with truncated JSON to every Nth API request")
+	fs.IntVar(&faults.LoginWallEvery, "login-wall-every", 0, "serve an HTML page in place of every Nth image")
+	fs.IntVar(&faults.RemovedImageEvery, "removed-image-every", 0, "redirect every Nth image to a removed image placeholder")
+	fs.DurationVar(&faults.Latency, "latency", 0, "delay added before every response, e.g. 500ms")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *fixtureDir == "" {
+		return fmt.Errorf("-fixtures must be set to a directory of images")
+	}
+
+	server := mock_reddit.NewServer(*fixtureDir, faults)
+	err = server.Start(*addr)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	logger.Info(fmt.Sprintf(
+		"Serving mock reddit API, set reddit_access_token_url to '%s', reddit_authorize_url to '%s' and reddit_api_endpoint to '%s' in your config",
+		server.AccessTokenURL(),
+		server.AuthorizeURL(),
+		server.URL(),
+	))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	logger.Info("Shutting down mock reddit API")
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/internal/reddit_cli"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+)
+
+func runPick(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("pick", flag.ContinueOnError)
+	brightness := fs.String("brightness", "", "'dark', 'light' or 'system' to follow the OS theme")
+	minLuminance := fs.Float64("min-luminance", 0, "minimum mean luminance from 0 to 1")
+	maxLuminance := fs.Float64("max-luminance", 0, "maximum mean luminance from 0 to 1, 0 is unset")
+	hues := fs.String("hues", "", "comma separated dominant hues to choose from e.g. blue,cyan")
+	includeLocations := fs.String("include-locations", "", "comma separated countries, continents or regions to choose from e.g. 'New Zealand,Patagonia'")
+	excludeLocations := fs.String("exclude-locations", "", "comma separated countries, continents or regions to never choose e.g. USA")
+	setWallpaper := fs.Bool("set", false, "also use the background as the desktop wallpaper")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	filters := map[string]interface{}{
+		"brightness":    *brightness,
+		"min_luminance": *minLuminance,
+		"max_luminance": *maxLuminance,
+	}
+	if *hues != "" {
+		filters["dominant_hues"] = strings.Split(*hues, ",")
+	}
+	if *includeLocations != "" {
+		filters["include_locations"] = strings.Split(*includeLocations, ",")
+	}
+	if *excludeLocations != "" {
+		filters["exclude_locations"] = strings.Split(*excludeLocations, ",")
+	}
+	pick := retriever.PickBackground
+	if *setWallpaper {
+		pick = retriever.PickWallpaper
+	}
+	fpath, err := pick(filters)
+	if err != nil {
+		return err
+	}
+	fmt.Println(fpath)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/internal/local_api"
+	"earthpullr/internal/reddit_cli"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const defaultApiListenAddress = "localhost:7878"
+
+func runServe(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "", fmt.Sprintf("loopback address to serve the API on, defaults to the api_listen_address config or %s", defaultApiListenAddress))
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	listenAddress := *addr
+	if listenAddress == "" {
+		listenAddress = conf.ApiListenAddress
+	}
+	if listenAddress == "" {
+		listenAddress = defaultApiListenAddress
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	server, err := local_api.StartServer(listenAddress, conf, retriever, logger)
+	if err != nil {
+		return err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	logger.Info("Stopping the API server")
+	// Event streams of a running fetch are cut off rather than waited for
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		return server.Close()
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/internal/reddit_cli"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+)
+
+func runVerify(args []string, conf config.Config, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	dir := fs.String("dir", "", "download directory to verify, defaults to the last used download path")
+	redownload := fs.Bool("redownload", false, "download missing and corrupt backgrounds again")
+	asJson := fs.Bool("json", false, "print the report as JSON")
+	wait := fs.Bool("wait", false, "wait for another earthpullr using the download directory to finish instead of failing")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	retriever, err := reddit_cli.NewBackgroundRetriever(context.Background(), logger, conf)
+	if err != nil {
+		return err
+	}
+	report, err := retriever.VerifyLibrary(map[string]interface{}{
+		"DownloadPath": *dir,
+		"Redownload":   *redownload,
+		"WaitForLock":  *wait,
+	})
+	if *asJson {
+		out, jsonErr := json.MarshalIndent(report, "", "  ")
+		if jsonErr != nil {
+			return jsonErr
+		}
+		fmt.Println(string(out))
+		return err
+	}
+	for _, fix := range report.Fixes {
+		if fix.Detail != "" {
+			fmt.Printf("%-26s %s (%s)\n", fix.Fix, fix.File, fix.Detail)
+		} else {
+			fmt.Printf("%-26s %s\n", fix.Fix, fix.File)
+		}
+	}
+	if report.DownloadPath != "" {
+		fmt.Fprintf(os.Stderr, "Checked %d backgrounds in %s, made %d fixes\n", report.Checked, report.DownloadPath, len(report.Fixes))
+	}
+	return err
+}
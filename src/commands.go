@@ -0,0 +1,95 @@
+package main
+
+import (
+	"earthpullr/internal/config"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+)
+
+type command struct {
+	description string
+	run         func(args []string, conf config.Config, logger *zap.Logger) error
+}
+
+var commands = map[string]command{
+	"attribution": {
+		description: "print the title, author and reddit link embedded into downloaded backgrounds",
+		run:         runAttribution,
+	},
+	"ban": {
+		description: "delete backgrounds and never download them or reposts of them again, or ban an author or domain",
+		run:         runBan,
+	},
+	"export": {
+		description: "bundle the config, user settings, favourites, bans and download index into an archive",
+		run:         runExport,
+	},
+	"export-catalog": {
+		description: "generate an offline HTML gallery of a download directory",
+		run:         runExportCatalog,
+	},
+	"fetch": {
+		description: "download new backgrounds with the last used settings, or list what would be downloaded with -dry-run",
+		run:         runFetch,
+	},
+	"favourite": {
+		description: "keep backgrounds forever, protecting them from bans and cleanup",
+		run:         runFavourite,
+	},
+	"favourites": {
+		description: "list or export the favourite backgrounds",
+		run:         runFavourites,
+	},
+	"import": {
+		description: "merge a library archive into this machine's settings, favourites, bans and download index",
+		run:         runImport,
+	},
+	"login": {
+		description: "log in to reddit as a user so user listings can be used as sources",
+		run:         runLogin,
+	},
+	"logout": {
+		description: "remove the stored reddit login",
+		run:         runLogout,
+	},
+	"mock-reddit": {
+		description: "serve an offline stand-in for the reddit API from a directory of images",
+		run:         runMockReddit,
+	},
+	"pick": {
+		description: "print a random downloaded background matching location, brightness and colour filters, or set it as the wallpaper",
+		run:         runPick,
+	},
+	"serve": {
+		description: "serve the local API without the desktop application",
+		run:         runServe,
+	},
+	"verify": {
+		description: "reconcile the download directory with its index, fixing missing, corrupt and unknown backgrounds",
+		run:         runVerify,
+	},
+}
+
+func runCommand(args []string, conf config.Config, logger *zap.Logger) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		printUsage()
+		return fmt.Errorf("unknown command '%s'", args[0])
+	}
+	return cmd.run(args[1:], conf, logger)
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: earthpullr [flags] [command [command flags]]\n\nCommands:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRunning without a command starts the desktop application.\n")
+}
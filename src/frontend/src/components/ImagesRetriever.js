@@ -85,6 +85,8 @@ class ImagesRetriever extends React.Component {
 				imagesHeight: {value: window.screen.height * window.devicePixelRatio, errMsg: "", valid: true, validator: imageDimensionValidation},
 				downloadPath: {value: "", errMsg: "", valid: true, validator: downloadPathValidation},
 			},
+			sources: [],
+			filters: {},
 			imagesSaved: 0,
 			responseMsg: "",
 			displayForm: true,
@@ -103,19 +105,28 @@ class ImagesRetriever extends React.Component {
 		this.handleSubmit = this.handleSubmit.bind(this);
 		this.setDisplayFormState = this.setDisplayFormState.bind(this);
 		this.handleUserInput = this.handleUserInput.bind(this);
-		this.setInitialDownloadPath = this.setInitialDownloadPath.bind(this);
+		this.setInitialSettings = this.setInitialSettings.bind(this);
 
-		window.backend.BackgroundRetriever.GetUserDownloadPath().then(result =>
-			this.setInitialDownloadPath(result)
+		window.backend.BackgroundRetriever.GetSettings().then(result =>
+			this.setInitialSettings(result)
 		)
 			.catch(err =>
 				console.log(err)
 		)
 	}
 
-	setInitialDownloadPath(downloadPath) {
+	setInitialSettings(settings) {
 		let newState = this.state;
-		newState.form.downloadPath.value = downloadPath
+		newState.form.downloadPath.value = settings.download_path
+		if (settings.width > 0 && settings.height > 0) {
+			newState.form.imagesWidth.value = settings.width
+			newState.form.imagesHeight.value = settings.height
+		}
+		if (settings.backgrounds_count > 0) {
+			newState.form.backgroundsCount.value = settings.backgrounds_count
+		}
+		newState.sources = settings.sources || []
+		newState.filters = settings.filters || {}
 		this.setState(newState);
 	}
 
@@ -172,7 +183,9 @@ class ImagesRetriever extends React.Component {
 				BackgroundsCount: parseInt(this.state.form.backgroundsCount.value),
 				Width: parseInt(this.state.form.imagesWidth.value),
 				Height: parseInt(this.state.form.imagesHeight.value),
-				DownloadPath: this.state.form.downloadPath.value
+				DownloadPath: this.state.form.downloadPath.value,
+				Sources: this.state.sources,
+				Filters: this.state.filters
 			}
 			window.backend.BackgroundRetriever.GetBackgrounds(request).then(result =>
 				this.setDisplayGetMoreImagesState()
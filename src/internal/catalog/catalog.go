@@ -0,0 +1,205 @@
+// Package catalog generates a static HTML gallery of a download directory which can be browsed offline and shared.
+package catalog
+
+import (
+	"earthpullr/internal/reddit_cli"
+	"earthpullr/pkg/image_format"
+	_ "embed"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"golang.org/x/image/draw"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed catalog.html.tmpl
+var catalogTemplate string
+
+const thumbnailsDirName = "thumbnails"
+
+type Options struct {
+	DownloadPath        string
+	ExistingImagesFname string
+	OutputDir           string
+	ThumbnailWidth      int
+}
+
+type entry struct {
+	reddit_cli.BackgroundMetadata
+	FileName      string
+	ImageHref     template.URL
+	ThumbnailHref string
+}
+
+type catalogPage struct {
+	Entries        []entry
+	Subreddits     []string
+	Countries      []string
+	ThumbnailWidth int
+	GeneratedAt    time.Time
+}
+
+// Export writes index.html and a thumbnails directory to the output directory, returning the number of backgrounds
+func Export(logger *zap.Logger, opts Options) (int, error) {
+	if opts.ThumbnailWidth <= 0 {
+		return 0, fmt.Errorf("thumbnail width must be positive, got %d", opts.ThumbnailWidth)
+	}
+	files, err := ioutil.ReadDir(opts.DownloadPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read download directory '%s': %v", opts.DownloadPath, err)
+	}
+	thumbnailsDir := filepath.Join(opts.OutputDir, thumbnailsDirName)
+	err = os.MkdirAll(thumbnailsDir, 0755)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create catalogue directory '%s': %v", thumbnailsDir, err)
+	}
+	index := reddit_cli.NewExistingBackgrounds(opts.DownloadPath, opts.ExistingImagesFname, logger).Backgrounds()
+
+	page := catalogPage{ThumbnailWidth: opts.ThumbnailWidth, GeneratedAt: time.Now()}
+	subreddits := map[string]bool{}
+	countries := map[string]bool{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || !isCatalogImage(file.Name()) {
+			continue
+		}
+		imagePath := filepath.Join(opts.DownloadPath, file.Name())
+		thumbnailPath := filepath.Join(thumbnailsDir, strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))+".jpg")
+		err = writeThumbnail(imagePath, thumbnailPath, file.ModTime(), opts.ThumbnailWidth)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Skipping '%s' in the catalogue", imagePath), zap.Error(err))
+			continue
+		}
+		imageHref, err := relativeHref(opts.OutputDir, imagePath)
+		if err != nil {
+			return 0, err
+		}
+		metadata, ok := index[file.Name()]
+		if !ok {
+			metadata = readSidecar(logger, imagePath)
+		}
+		if metadata.SavedAt.IsZero() {
+			metadata.SavedAt = file.ModTime()
+		}
+		page.Entries = append(page.Entries, entry{
+			BackgroundMetadata: metadata,
+			FileName:           file.Name(),
+			ImageHref:          imageHref,
+			ThumbnailHref:      thumbnailsDirName + "/" + filepath.Base(thumbnailPath),
+		})
+		if metadata.Subreddit != "" {
+			subreddits[metadata.Subreddit] = true
+		}
+		if metadata.Location != nil && metadata.Location.Country != "" {
+			countries[metadata.Location.Country] = true
+		}
+	}
+	sort.Slice(page.Entries, func(i, j int) bool {
+		return page.Entries[i].SavedAt.After(page.Entries[j].SavedAt)
+	})
+	for subreddit := range subreddits {
+		page.Subreddits = append(page.Subreddits, subreddit)
+	}
+	sort.Strings(page.Subreddits)
+	for country := range countries {
+		page.Countries = append(page.Countries, country)
+	}
+	sort.Strings(page.Countries)
+
+	tmpl, err := template.New("catalog").Parse(catalogTemplate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse catalogue template: %v", err)
+	}
+	out, err := os.Create(filepath.Join(opts.OutputDir, "index.html"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create catalogue: %v", err)
+	}
+	defer out.Close()
+	err = tmpl.Execute(out, page)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write catalogue: %v", err)
+	}
+	return len(page.Entries), nil
+}
+
+func isCatalogImage(fname string) bool {
+	return image_format.FormatOfExtension(strings.ToLower(filepath.Ext(fname))) != ""
+}
+
+// relativeHref links to the image relative to the catalogue. Both kinds of link are built with url.URL so they're
+// escaped, the file URL fallback is then marked safe as html/template would otherwise replace its scheme.
+func relativeHref(outputDir string, imagePath string) (template.URL, error) {
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return "", err
+	}
+	absImagePath, err := filepath.Abs(imagePath)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absOutputDir, absImagePath)
+	if err != nil {
+		// e.g. a different drive on Windows, an absolute file URL still works offline
+		return fileHref(filepath.ToSlash(absImagePath)), nil
+	}
+	relURL := url.URL{Path: filepath.ToSlash(rel)}
+	return template.URL(relURL.String()), nil
+}
+
+// fileHref is passed an absolute slash separated path such as /home/backgrounds/a.jpg or C:/backgrounds/a.jpg
+func fileHref(absPath string) template.URL {
+	fileURL := url.URL{Scheme: "file", Path: absPath}
+	if !strings.HasPrefix(fileURL.Path, "/") {
+		fileURL.Path = "/" + fileURL.Path
+	}
+	return template.URL(fileURL.String())
+}
+
+// readSidecar is used for backgrounds missing from the index, an empty metadata is returned when there is no sidecar
+func readSidecar(logger *zap.Logger, imagePath string) reddit_cli.BackgroundMetadata {
+	metadata, err := reddit_cli.ReadSidecar(imagePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Warn(fmt.Sprintf("Failed to read the metadata sidecar of '%s'", imagePath), zap.Error(err))
+	}
+	return metadata
+}
+
+// writeThumbnail is skipped when a thumbnail newer than the image already exists
+func writeThumbnail(imagePath string, thumbnailPath string, imageModTime time.Time, width int) error {
+	if info, err := os.Stat(thumbnailPath); err == nil && info.ModTime().After(imageModTime) {
+		return nil
+	}
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %v", err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return fmt.Errorf("image has no pixels")
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height == 0 {
+		height = 1
+	}
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(thumbnail, thumbnail.Bounds(), img, bounds, draw.Src, nil)
+	out, err := os.Create(thumbnailPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return jpeg.Encode(out, thumbnail, &jpeg.Options{Quality: 80})
+}
@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	"bytes"
+	"html/template"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func renderHref(t *testing.T, href template.URL) string {
+	t.Helper()
+	tmpl := template.Must(template.New("href").Parse(`<a href="{{.}}">`))
+	var out bytes.Buffer
+	err := tmpl.Execute(&out, href)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestRelativeHref(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		outputDir string
+		imagePath string
+		want      string
+	}{
+		{filepath.Join(root, "catalogue"), filepath.Join(root, "t3_abc.jpg"), "../t3_abc.jpg"},
+		{root, filepath.Join(root, "t3_abc.jpg"), "t3_abc.jpg"},
+		{filepath.Join(root, "catalogue"), filepath.Join(root, "my backgrounds", "t3_abc.jpg"), "../my%20backgrounds/t3_abc.jpg"},
+	}
+	for _, test := range tests {
+		href, err := relativeHref(test.outputDir, test.imagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(href) != test.want {
+			t.Errorf("got '%s', want '%s'", href, test.want)
+		}
+		if rendered := renderHref(t, href); !strings.Contains(rendered, test.want) {
+			t.Errorf("rendered '%s', want it to link to '%s'", rendered, test.want)
+		}
+	}
+}
+
+func TestFileHref(t *testing.T) {
+	tests := map[string]string{
+		"/home/user/backgrounds/t3_abc.jpg": "file:///home/user/backgrounds/t3_abc.jpg",
+		"D:/My Backgrounds/t3_abc.jpg":      "file:///D:/My%20Backgrounds/t3_abc.jpg",
+	}
+	for absPath, want := range tests {
+		href := fileHref(absPath)
+		if string(href) != want {
+			t.Errorf("got '%s', want '%s'", href, want)
+		}
+		if rendered := renderHref(t, href); rendered != `<a href="`+want+`">` {
+			t.Errorf("rendered '%s', want it to link to '%s'", rendered, want)
+		}
+	}
+}
@@ -8,21 +8,58 @@ import (
 )
 
 type Config struct {
-	RedditAccessTokenUrl       string `json:"reddit_access_token_url"`
-	RedditGrantTypeHeader      string `json:"reddit_grant_type_header"`
-	RedditDeviceIdHeader       string `json:"reddit_device_id_header"`
-	RedditContentTypeHeader    string `json:"reddit_content_type_header"`
-	RedditApiEndpoint          string `json:"reddit_api_endpoint"`
-	Version                    string `json:"version"`
-	Platform                   string `json:"platform"`
-	ApplicationName            string `json:"application_name"`
-	Subreddit                  string `json:"subreddit"`
-	SubredditSearchType        string `json:"subreddit_search_type"`
-	QueryBatchSize             int    `json:"query_batch_size"`
-	MaxAggregatedQueryTimeSecs int    `json:"max_aggregated_query_time_secs"`
-	ExistingImagesFilename     string `json:"existing_images_filename"`
-	RedditAppClientId          string `json:"reddit_app_client_id"`
-	UserSettingsFname          string `json:"user_settings_fname"`
+	RedditAccessTokenUrl             string   `json:"reddit_access_token_url"`
+	RedditGrantTypeHeader            string   `json:"reddit_grant_type_header"`
+	RedditDeviceIdHeader             string   `json:"reddit_device_id_header"`
+	RedditContentTypeHeader          string   `json:"reddit_content_type_header"`
+	RedditApiEndpoint                string   `json:"reddit_api_endpoint"`
+	Version                          string   `json:"version"`
+	Platform                         string   `json:"platform"`
+	ApplicationName                  string   `json:"application_name"`
+	Subreddit                        string   `json:"subreddit"`
+	SubredditSearchType              string   `json:"subreddit_search_type"`
+	QueryBatchSize                   int      `json:"query_batch_size"`
+	MaxAggregatedQueryTimeSecs       int      `json:"max_aggregated_query_time_secs"`
+	ExistingImagesFilename           string   `json:"existing_images_filename"`
+	DownloadLockFilename             string   `json:"download_lock_filename"`
+	RedditAppClientId                string   `json:"reddit_app_client_id"`
+	RedditAuthorizeUrl               string   `json:"reddit_authorize_url"`
+	RedditRedirectUri                string   `json:"reddit_redirect_uri"`
+	RedditOAuthScopes                []string `json:"reddit_oauth_scopes"`
+	RedditLoginFname                 string   `json:"reddit_login_fname"`
+	CurationFname                    string   `json:"curation_fname"`
+	UserSettingsFname                string   `json:"user_settings_fname"`
+	LogLevel                         string   `json:"log_level"`
+	LogEncoding                      string   `json:"log_encoding"`
+	LogOutputPaths                   []string `json:"log_output_paths"`
+	LogMaxSizeMB                     int      `json:"log_max_size_mb"`
+	LogMaxAgeDays                    int      `json:"log_max_age_days"`
+	LogMaxBackups                    int      `json:"log_max_backups"`
+	HttpMaxAttempts                  int      `json:"http_max_attempts"`
+	HttpTimeoutSecs                  int      `json:"http_timeout_secs"`
+	HttpProxyUrl                     string   `json:"http_proxy_url"`
+	HttpCaBundlePaths                []string `json:"http_ca_bundle_paths"`
+	HttpClientCertPath               string   `json:"http_client_cert_path"`
+	HttpClientKeyPath                string   `json:"http_client_key_path"`
+	MetricsListenAddress             string   `json:"metrics_listen_address"`
+	ApiListenAddress                 string   `json:"api_listen_address"`
+	ApiTokenFname                    string   `json:"api_token_fname"`
+	BandwidthLimitBytesPerSec        int64    `json:"bandwidth_limit_bytes_per_sec"`
+	MeteredBandwidthLimitBytesPerSec int64    `json:"metered_bandwidth_limit_bytes_per_sec"`
+	TitleIncludeKeywords             []string `json:"title_include_keywords"`
+	TitleExcludeKeywords             []string `json:"title_exclude_keywords"`
+	TitleIncludePatterns             []string `json:"title_include_patterns"`
+	TitleExcludePatterns             []string `json:"title_exclude_patterns"`
+	WriteSidecars                    bool     `json:"write_sidecars"`
+	ImageSavedHook                   []string `json:"image_saved_hook"`
+	RunFinishedHook                  []string `json:"run_finished_hook"`
+	HookTimeoutSecs                  int      `json:"hook_timeout_secs"`
+	DesktopNotifications             bool     `json:"desktop_notifications"`
+	NotifyRunFinished                bool     `json:"notify_run_finished"`
+	NotifyRateLimited                bool     `json:"notify_rate_limited"`
+	NotifyAuthFailed                 bool     `json:"notify_auth_failed"`
+	NotifyDiskFull                   bool     `json:"notify_disk_full"`
+	NotifyOtherFailures              bool     `json:"notify_other_failures"`
 }
 
 func NewConfig(fpathOverride string) (Config, error) {
@@ -48,8 +85,37 @@ func NewDefaultConfig() Config {
 		QueryBatchSize: 100,
 		MaxAggregatedQueryTimeSecs: 30,
 		ExistingImagesFilename: ".earthpullr_existing_images.json",
+		DownloadLockFilename: ".earthpullr.lock",
 		RedditAppClientId: "3gMaLS0rRxDTdEWErlrTEg",
+		RedditAuthorizeUrl: "https://www.reddit.com/api/v1/authorize",
+		RedditRedirectUri: "http://127.0.0.1:65010/authorize_callback",
+		RedditOAuthScopes: []string{"identity", "read", "history"},
+		RedditLoginFname: "earthpullr_reddit_login.json",
+		CurationFname: "earthpullr_curation.json",
 		UserSettingsFname: "earthpullr_user_settings.json",
+		LogLevel: "info",
+		LogEncoding: "json",
+		LogOutputPaths: nil, // stdout and a log file within the user's state directory
+		LogMaxSizeMB: 10,
+		LogMaxAgeDays: 28,
+		LogMaxBackups: 5,
+		HttpMaxAttempts: 3,
+		HttpTimeoutSecs: 10,
+		HttpProxyUrl: "", // Falls back to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+		MetricsListenAddress: "", // Metrics are only served when an address such as "localhost:9090" is set
+		ApiListenAddress: "", // The local API is only served when a loopback address such as "localhost:7878" is set
+		ApiTokenFname: "earthpullr_api_token",
+		BandwidthLimitBytesPerSec: 0, // Unlimited
+		MeteredBandwidthLimitBytesPerSec: 0, // Unlimited
+		ImageSavedHook: nil, // Commands e.g. ["sh", "-c", "wal -i \"$EARTHPULLR_IMAGE_PATH\""], run after each saved image
+		RunFinishedHook: nil, // and after each request for backgrounds finishes
+		HookTimeoutSecs: 30,
+		DesktopNotifications: false, // Sent over D-Bus to the freedesktop notification daemon when enabled
+		NotifyRunFinished: true,
+		NotifyRateLimited: true,
+		NotifyAuthFailed: true,
+		NotifyDiskFull: true,
+		NotifyOtherFailures: true,
 	}
 }
 
@@ -63,7 +129,8 @@ func NewConfigFromFile(fpathOverride string) (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
-	var config Config
+	// Any values missing from the file keep their defaults
+	config := NewDefaultConfig()
 	err = json.Unmarshal(byteValue, &config)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to unmarshall json config file: %v", err)
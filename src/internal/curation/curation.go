@@ -0,0 +1,322 @@
+// Package curation persists the backgrounds a user wants to keep forever and the posts, reposts, authors and
+// domains they never want to see again.
+package curation
+
+import (
+	"earthpullr/pkg/image_hash"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxRepostDistance is how many bits an image hash may differ from a banned one and still be treated as a repost
+const MaxRepostDistance = 4
+
+const (
+	ExportFormatText = "text"
+	ExportFormatJson = "json"
+)
+
+type Favourite struct {
+	PostID   string    `json:"post_id"`
+	FilePath string    `json:"file_path"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+type BannedPost struct {
+	PostID string `json:"post_id"`
+	// Hash is nil when the banned file could not be decoded, only the post itself is banned then
+	Hash     *image_hash.Hash `json:"hash,omitempty"`
+	BannedAt time.Time        `json:"banned_at"`
+}
+
+type lists struct {
+	Favourites    map[string]Favourite  `json:"favourites"`
+	BannedPosts   map[string]BannedPost `json:"banned_posts"`
+	BannedAuthors []string              `json:"banned_authors"`
+	BannedDomains []string              `json:"banned_domains"`
+}
+
+// Manager is shared by the desktop application and any in progress request for backgrounds, so is safe for
+// concurrent use
+type Manager struct {
+	mu    sync.Mutex
+	fpath string
+	lists lists
+}
+
+func NewManager(applicationName string, curationFname string) (*Manager, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	manager := &Manager{
+		fpath: filepath.Join(configDir, applicationName, curationFname),
+		lists: lists{
+			Favourites:  map[string]Favourite{},
+			BannedPosts: map[string]BannedPost{},
+		},
+	}
+	byteValue, err := ioutil.ReadFile(manager.fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return manager, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read favourites and bans: %v", err)
+	}
+	err = json.Unmarshal(byteValue, &manager.lists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshall favourites and bans: %v", err)
+	}
+	if manager.lists.Favourites == nil {
+		manager.lists.Favourites = map[string]Favourite{}
+	}
+	if manager.lists.BannedPosts == nil {
+		manager.lists.BannedPosts = map[string]BannedPost{}
+	}
+	return manager, nil
+}
+
+func (m *Manager) save() error {
+	out, err := json.MarshalIndent(m.lists, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshall favourites and bans: %v", err)
+	}
+	// Like the stored login, user data is only readable by the user
+	err = os.MkdirAll(filepath.Dir(m.fpath), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create favourites and bans directory: %v", err)
+	}
+	err = ioutil.WriteFile(m.fpath, out, 0600)
+	if err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file, such as one written by an older version
+	return os.Chmod(m.fpath, 0600)
+}
+
+func (m *Manager) AddFavourite(postID string, filePath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lists.BannedPosts[postID]; ok {
+		return fmt.Errorf("post '%s' is banned", postID)
+	}
+	m.lists.Favourites[postID] = Favourite{PostID: postID, FilePath: filePath, AddedAt: time.Now().UTC()}
+	return m.save()
+}
+
+func (m *Manager) RemoveFavourite(postID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lists.Favourites[postID]; !ok {
+		return fmt.Errorf("post '%s' is not a favourite", postID)
+	}
+	delete(m.lists.Favourites, postID)
+	return m.save()
+}
+
+// IsFavourite is true for backgrounds which must never be removed by a ban or any cleanup
+func (m *Manager) IsFavourite(postID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.lists.Favourites[postID]
+	return ok
+}
+
+// Favourites returns the favourites in the order they were added
+func (m *Manager) Favourites() []Favourite {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	favourites := []Favourite{}
+	for _, favourite := range m.lists.Favourites {
+		favourites = append(favourites, favourite)
+	}
+	sort.Slice(favourites, func(i, j int) bool {
+		return favourites[i].AddedAt.Before(favourites[j].AddedAt)
+	})
+	return favourites
+}
+
+// ExportFavourites writes the favourites as one file path per line for the text format, or as a JSON array
+func (m *Manager) ExportFavourites(w io.Writer, format string) error {
+	favourites := m.Favourites()
+	switch format {
+	case ExportFormatText:
+		for _, favourite := range favourites {
+			if _, err := fmt.Fprintln(w, favourite.FilePath); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ExportFormatJson:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(favourites)
+	default:
+		return fmt.Errorf("unknown export format '%s', must be one of '%s' or '%s'", format, ExportFormatText, ExportFormatJson)
+	}
+}
+
+// Export writes every favourite and ban as JSON to be merged into another library with Merge
+func (m *Manager) Export(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m.lists)
+}
+
+// Merge adds the favourites and bans of an export which aren't already present, returning how many were added.
+// remapPath is applied to the file paths of favourites. Favourites banned here and bans of favourites here are skipped.
+func (m *Manager) Merge(r io.Reader, remapPath func(fpath string) string) (int, error) {
+	var imported lists
+	err := json.NewDecoder(r).Decode(&imported)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshall favourites and bans: %v", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added := 0
+	for postID, favourite := range imported.Favourites {
+		if _, ok := m.lists.Favourites[postID]; ok {
+			continue
+		}
+		if _, ok := m.lists.BannedPosts[postID]; ok {
+			continue
+		}
+		favourite.FilePath = remapPath(favourite.FilePath)
+		m.lists.Favourites[postID] = favourite
+		added++
+	}
+	for postID, banned := range imported.BannedPosts {
+		if _, ok := m.lists.BannedPosts[postID]; ok {
+			continue
+		}
+		if _, ok := m.lists.Favourites[postID]; ok {
+			continue
+		}
+		m.lists.BannedPosts[postID] = banned
+		added++
+	}
+	for _, author := range imported.BannedAuthors {
+		if !contains(m.lists.BannedAuthors, author) {
+			m.lists.BannedAuthors = append(m.lists.BannedAuthors, author)
+			added++
+		}
+	}
+	for _, domain := range imported.BannedDomains {
+		if !contains(m.lists.BannedDomains, domain) {
+			m.lists.BannedDomains = append(m.lists.BannedDomains, domain)
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, m.save()
+}
+
+// BanPost stops the post, and any repost of an image with a similar hash, from being downloaded again
+func (m *Manager) BanPost(postID string, hash *image_hash.Hash) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lists.Favourites[postID]; ok {
+		return fmt.Errorf("post '%s' is a favourite, remove it from the favourites before banning it", postID)
+	}
+	m.lists.BannedPosts[postID] = BannedPost{PostID: postID, Hash: hash, BannedAt: time.Now().UTC()}
+	return m.save()
+}
+
+func (m *Manager) BanAuthor(author string) error {
+	author = normaliseAuthor(author)
+	if author == "" {
+		return fmt.Errorf("an author must be specified")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lists.BannedAuthors = appendUnique(m.lists.BannedAuthors, author)
+	return m.save()
+}
+
+func (m *Manager) BanDomain(domain string) error {
+	domain = normaliseDomain(domain)
+	if domain == "" {
+		return fmt.Errorf("a domain must be specified")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lists.BannedDomains = appendUnique(m.lists.BannedDomains, domain)
+	return m.save()
+}
+
+func (m *Manager) IsBannedPost(postID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.lists.BannedPosts[postID]
+	return ok
+}
+
+func (m *Manager) IsBannedAuthor(author string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return contains(m.lists.BannedAuthors, normaliseAuthor(author))
+}
+
+// IsBannedDomain also matches subdomains of a banned domain, e.g. i.imgur.com when imgur.com is banned
+func (m *Manager) IsBannedDomain(domain string) bool {
+	domain = normaliseDomain(domain)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, banned := range m.lists.BannedDomains {
+		if domain == banned || strings.HasSuffix(domain, "."+banned) {
+			return true
+		}
+	}
+	return false
+}
+
+// BannedRepostOf returns the ID of the banned post whose image looks like hash, or an empty string if there is none
+func (m *Manager) BannedRepostOf(hash image_hash.Hash) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for postID, banned := range m.lists.BannedPosts {
+		if banned.Hash != nil && image_hash.Distance(*banned.Hash, hash) <= MaxRepostDistance {
+			return postID
+		}
+	}
+	return ""
+}
+
+func normaliseAuthor(author string) string {
+	author = strings.TrimSpace(author)
+	author = strings.TrimPrefix(strings.TrimPrefix(author, "/"), "u/")
+	return strings.ToLower(author)
+}
+
+func normaliseDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	return strings.TrimPrefix(domain, "www.")
+}
+
+func appendUnique(values []string, value string) []string {
+	if contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,316 @@
+package curation
+
+import (
+	"bytes"
+	"earthpullr/pkg/image_hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testCurationFname = "curation.json"
+
+// newTestManager gives the test its own user config directory, returning a manager reading from it
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	configDir := t.TempDir()
+	for _, key := range []string{"XDG_CONFIG_HOME", "HOME", "AppData"} {
+		previous, ok := os.LookupEnv(key)
+		os.Setenv(key, configDir)
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+	return reloadManager(t)
+}
+
+func reloadManager(t *testing.T) *Manager {
+	t.Helper()
+	manager, err := NewManager("earthpullr", testCurationFname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func hashOf(value uint64) *image_hash.Hash {
+	hash := image_hash.Hash(value)
+	return &hash
+}
+
+func TestFavourites(t *testing.T) {
+	manager := newTestManager(t)
+	for _, postID := range []string{"t3_a", "t3_b"} {
+		err := manager.AddFavourite(postID, "/backgrounds/"+postID+".jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !manager.IsFavourite("t3_a") || manager.IsFavourite("t3_c") {
+		t.Fatal("expected only the added posts to be favourites")
+	}
+	if err := manager.BanPost("t3_a", nil); err == nil {
+		t.Fatal("expected banning a favourite to fail")
+	}
+
+	err := manager.RemoveFavourite("t3_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.RemoveFavourite("t3_a"); err == nil {
+		t.Fatal("expected removing a post which isn't a favourite to fail")
+	}
+	favourites := manager.Favourites()
+	if len(favourites) != 1 || favourites[0].PostID != "t3_b" || favourites[0].FilePath != "/backgrounds/t3_b.jpg" {
+		t.Fatalf("got favourites %+v", favourites)
+	}
+
+	var text bytes.Buffer
+	err = manager.ExportFavourites(&text, ExportFormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.String() != "/backgrounds/t3_b.jpg\n" {
+		t.Fatalf("exported '%s'", text.String())
+	}
+	if err := manager.ExportFavourites(&text, "csv"); err == nil {
+		t.Fatal("expected an unknown export format to fail")
+	}
+}
+
+func TestBanPost(t *testing.T) {
+	manager := newTestManager(t)
+	err := manager.BanPost("t3_a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !manager.IsBannedPost("t3_a") || manager.IsBannedPost("t3_b") {
+		t.Fatal("expected only the banned post to be banned")
+	}
+	if err := manager.AddFavourite("t3_a", "/backgrounds/t3_a.jpg"); err == nil {
+		t.Fatal("expected adding a banned post to the favourites to fail")
+	}
+}
+
+func TestBannedRepostOf(t *testing.T) {
+	manager := newTestManager(t)
+	banned := uint64(0xF0F0F0F0F0F0F0F0)
+	err := manager.BanPost("t3_a", hashOf(banned))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A ban without a hash never matches reposts
+	err = manager.BanPost("t3_b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		hash uint64
+		want string
+	}{
+		{name: "same image", hash: banned, want: "t3_a"},
+		{name: "one bit different", hash: banned ^ 1, want: "t3_a"},
+		{name: "at the maximum distance", hash: banned ^ 0xF, want: "t3_a"},
+		{name: "past the maximum distance", hash: banned ^ 0x1F, want: ""},
+		{name: "different image", hash: ^banned, want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := manager.BannedRepostOf(image_hash.Hash(test.hash)); got != test.want {
+				t.Fatalf("got repost of '%s', want '%s'", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBanAuthor(t *testing.T) {
+	manager := newTestManager(t)
+	for _, author := range []string{"/u/SomeOne", "someone", ""} {
+		err := manager.BanAuthor(author)
+		if author == "" {
+			if err == nil {
+				t.Fatal("expected banning an empty author to fail")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(manager.lists.BannedAuthors) != 1 {
+		t.Fatalf("expected the author to be banned once, got %v", manager.lists.BannedAuthors)
+	}
+	for _, author := range []string{"someone", "SOMEONE", "u/someone"} {
+		if !manager.IsBannedAuthor(author) {
+			t.Fatalf("expected '%s' to be banned", author)
+		}
+	}
+	if manager.IsBannedAuthor("someone_else") {
+		t.Fatal("expected another author not to be banned")
+	}
+}
+
+func TestBanDomain(t *testing.T) {
+	manager := newTestManager(t)
+	err := manager.BanDomain("www.Imgur.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.BanDomain(" "); err == nil {
+		t.Fatal("expected banning an empty domain to fail")
+	}
+	for domain, want := range map[string]bool{
+		"imgur.com":       true,
+		"i.imgur.com":     true,
+		"www.imgur.com":   true,
+		"notimgur.com":    false,
+		"imgur.com.au":    false,
+		"i.redd.it":       false,
+		"imgur.com.evil.": false,
+	} {
+		if got := manager.IsBannedDomain(domain); got != want {
+			t.Fatalf("got '%s' banned %t, want %t", domain, got, want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	exporter := newTestManager(t)
+	err := exporter.AddFavourite("t3_fav", "/old/backgrounds/t3_fav.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, postID := range []string{"t3_banned", "t3_local_fav"} {
+		err = exporter.BanPost(postID, hashOf(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = exporter.BanAuthor("someone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exporter.BanDomain("imgur.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export bytes.Buffer
+	err = exporter.Export(&export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := newTestManager(t)
+	// A local favourite wins over the exported ban of the same post
+	err = manager.AddFavourite("t3_local_fav", "/backgrounds/t3_local_fav.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.BanDomain("imgur.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := manager.Merge(bytes.NewReader(export.Bytes()), func(fpath string) string {
+		return strings.Replace(fpath, "/old/backgrounds", "/backgrounds", 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The favourite, banned post and author
+	if added != 3 {
+		t.Fatalf("added %d, want 3", added)
+	}
+	favourites := manager.Favourites()
+	if len(favourites) != 2 || !manager.IsFavourite("t3_fav") || manager.IsBannedPost("t3_local_fav") {
+		t.Fatalf("got favourites %+v", favourites)
+	}
+	for _, favourite := range favourites {
+		if favourite.PostID == "t3_fav" && favourite.FilePath != "/backgrounds/t3_fav.jpg" {
+			t.Fatalf("expected the favourite's path to be remapped, got '%s'", favourite.FilePath)
+		}
+	}
+	if !manager.IsBannedPost("t3_banned") || !manager.IsBannedAuthor("someone") || len(manager.lists.BannedDomains) != 1 {
+		t.Fatalf("got bans %+v", manager.lists)
+	}
+
+	added, err = manager.Merge(bytes.NewReader(export.Bytes()), func(fpath string) string { return fpath })
+	if err != nil || added != 0 {
+		t.Fatalf("expected merging again to add nothing, got %d and %v", added, err)
+	}
+	if _, err := manager.Merge(strings.NewReader("{"), nil); err == nil {
+		t.Fatal("expected merging malformed JSON to fail")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	manager := newTestManager(t)
+	err := manager.AddFavourite("t3_fav", "/backgrounds/t3_fav.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.BanPost("t3_banned", hashOf(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.BanAuthor("someone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.BanDomain("imgur.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := reloadManager(t)
+	if !reloaded.IsFavourite("t3_fav") || !reloaded.IsBannedAuthor("someone") || !reloaded.IsBannedDomain("imgur.com") {
+		t.Fatalf("got %+v after reloading", reloaded.lists)
+	}
+	if reloaded.BannedRepostOf(42) != "t3_banned" {
+		t.Fatal("expected the banned post's hash to be reloaded")
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(manager.fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("favourites and bans were written with mode %o, want 0600", info.Mode().Perm())
+		}
+	}
+}
+
+func TestSaveTightensExistingFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes aren't enforced on windows")
+	}
+	manager := newTestManager(t)
+	err := os.MkdirAll(filepath.Dir(manager.fpath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(manager.fpath, []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = manager.BanDomain("imgur.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(manager.fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("got mode %o, want the file written by an older version to be tightened to 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,266 @@
+// Package gazetteer maps the free text locations of post titles to countries and continents using an embedded list of
+// countries, regions and natural landmarks, so no geocoding service is needed.
+package gazetteer
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//go:embed gazetteer.txt
+var gazetteerData string
+
+const (
+	kindContinent = "continent"
+	kindCountry   = "country"
+	kindRegion    = "region"
+)
+
+type place struct {
+	name      string
+	kind      string
+	countries []string
+	continent string
+}
+
+// Location is nil or empty when nothing in the title is recognised
+type Location struct {
+	Country   string `json:"country,omitempty"`
+	Continent string `json:"continent,omitempty"`
+	// Regions are the regions and landmarks mentioned, e.g. Patagonia or Yosemite
+	Regions []string `json:"regions,omitempty"`
+}
+
+func (location Location) IsEmpty() bool {
+	return location.Country == "" && location.Continent == "" && len(location.Regions) == 0
+}
+
+// Matches is true if the canonical place name is the country, continent or one of the regions of the location
+func (location Location) Matches(name string) bool {
+	if name == location.Country || name == location.Continent {
+		return true
+	}
+	for _, region := range location.Regions {
+		if name == region {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// Words may contain apostrophes, hyphens and dots e.g. Giant's, Timor-Leste and U.S.A.
+	wordPattern = regexp.MustCompile(`[\pL\pN]+(?:['’.\-][\pL\pN]+)*\.?`)
+
+	// Aliases written with capitals such as US or CA are abbreviations, they're only matched with the same case so
+	// they don't match words like "us" or "ca". An alias can belong to several places e.g. Georgia
+	caseSensitiveAliases   = map[string][]*place{}
+	caseInsensitiveAliases = map[string][]*place{}
+	maxAliasWords          = 1
+)
+
+func init() {
+	for i, line := range strings.Split(gazetteerData, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if len(fields) != 5 {
+			panic(fmt.Sprintf("malformed gazetteer line %d: %s", i+1, line))
+		}
+		p := &place{name: fields[0], kind: fields[1], continent: fields[3]}
+		if fields[2] != "" {
+			p.countries = strings.Split(fields[2], ";")
+		}
+		addAlias(p.name, p, false)
+		if fields[4] == "" {
+			continue
+		}
+		for _, alias := range strings.Split(fields[4], ";") {
+			addAlias(alias, p, alias != strings.ToLower(alias))
+		}
+	}
+}
+
+func addAlias(alias string, p *place, caseSensitive bool) {
+	words := normaliseWords(alias)
+	if len(words) > maxAliasWords {
+		maxAliasWords = len(words)
+	}
+	key := strings.Join(words, " ")
+	if caseSensitive {
+		caseSensitiveAliases[key] = append(caseSensitiveAliases[key], p)
+	} else {
+		key = strings.ToLower(key)
+		caseInsensitiveAliases[key] = append(caseInsensitiveAliases[key], p)
+	}
+}
+
+// normaliseWords splits text into words, dropping full stops ending a sentence or abbreviation like "St." but keeping
+// those of dotted abbreviations like "U.S."
+func normaliseWords(text string) []string {
+	words := wordPattern.FindAllString(text, -1)
+	for i, word := range words {
+		if strings.Count(word, ".") == 1 && strings.HasSuffix(word, ".") {
+			words[i] = strings.TrimSuffix(word, ".")
+		}
+	}
+	return words
+}
+
+// Lookup finds the places mentioned in text, preferring the longest alias at each word so "South America" isn't
+// mistaken for "America". Titles conventionally end with the country so the last country wins, unless a region within
+// a single country follows it e.g. "Jordan Lake, North Carolina" is in the United States. Regions in a different
+// country to the chosen one are ignored.
+func Lookup(text string) Location {
+	var location Location
+	var continent string
+	matches := resolveAmbiguous(findPlaces(text))
+	for _, p := range matches {
+		switch {
+		case p.kind == kindCountry:
+			location.Country = p.name
+		case p.kind == kindRegion && len(p.countries) == 1:
+			location.Country = p.countries[0]
+		case p.kind == kindContinent:
+			continent = p.name
+		}
+	}
+	for _, p := range matches {
+		if p.kind != kindRegion || (location.Country != "" && !contains(p.countries, location.Country)) {
+			continue
+		}
+		if !contains(location.Regions, p.name) {
+			location.Regions = append(location.Regions, p.name)
+		}
+		if location.Continent == "" {
+			location.Continent = p.continent
+		}
+	}
+	if location.Country != "" {
+		location.Continent = countryContinent(location.Country)
+	}
+	if location.Continent == "" {
+		location.Continent = continent
+	}
+	return location
+}
+
+// findPlaces returns the candidate places of each alias found in text, in the order they're mentioned
+func findPlaces(text string) [][]*place {
+	var found [][]*place
+	for _, segment := range strings.Split(text, ",") {
+		words := normaliseWords(segment)
+		for i := 0; i < len(words); {
+			places, n := longestMatch(words[i:])
+			if places == nil {
+				i++
+				continue
+			}
+			found = append(found, places)
+			i += n
+		}
+	}
+	return found
+}
+
+// resolveAmbiguous picks the candidate of each ambiguous alias in a country mentioned elsewhere in the text, e.g.
+// Georgia in "Savannah, Georgia, USA" is the state. Aliases that can't be resolved are dropped.
+func resolveAmbiguous(found [][]*place) []*place {
+	var mentioned []string
+	for _, places := range found {
+		if len(places) == 1 {
+			mentioned = append(mentioned, places[0].countriesOrName()...)
+		}
+	}
+	var matches []*place
+	for _, places := range found {
+		if len(places) == 1 {
+			matches = append(matches, places[0])
+			continue
+		}
+		var agreeing []*place
+		for _, p := range places {
+			for _, country := range p.countriesOrName() {
+				if contains(mentioned, country) {
+					agreeing = append(agreeing, p)
+					break
+				}
+			}
+		}
+		if len(agreeing) == 1 {
+			matches = append(matches, agreeing[0])
+		}
+	}
+	return matches
+}
+
+func (p *place) countriesOrName() []string {
+	if p.kind == kindCountry {
+		return []string{p.name}
+	}
+	return p.countries
+}
+
+// longestMatch matches words against the aliases. Two letter abbreviations of regions like CO or NC are only matched
+// when they end the words, as in "Maroon Bells, CO", so an English word written in capitals isn't mistaken for one.
+func longestMatch(words []string) ([]*place, int) {
+	for n := maxAliasWords; n > 0; n-- {
+		if n > len(words) {
+			continue
+		}
+		key := strings.Join(words[:n], " ")
+		if places, ok := caseSensitiveAliases[key]; ok && (len(key) != 2 || n == len(words) || !onlyRegions(places)) {
+			return places, n
+		}
+		if places, ok := caseInsensitiveAliases[strings.ToLower(key)]; ok {
+			return places, n
+		}
+	}
+	return nil, 0
+}
+
+func onlyRegions(places []*place) bool {
+	for _, p := range places {
+		if p.kind != kindRegion {
+			return false
+		}
+	}
+	return true
+}
+
+func countryContinent(country string) string {
+	for _, p := range caseInsensitiveAliases[strings.ToLower(country)] {
+		if p.kind == kindCountry {
+			return p.continent
+		}
+	}
+	return ""
+}
+
+// Canonical resolves a place name or any of its aliases, ignoring case, to the name used in a Location
+func Canonical(name string) (string, error) {
+	key := strings.ToLower(strings.Join(normaliseWords(name), " "))
+	// An ambiguous alias resolves to the first place listed, the others can be chosen by name e.g. "Georgia (US)"
+	if places, ok := caseInsensitiveAliases[key]; ok {
+		return places[0].name, nil
+	}
+	for alias, places := range caseSensitiveAliases {
+		if strings.ToLower(alias) == key {
+			return places[0].name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown location '%s', it must be a country, continent, region or landmark", name)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
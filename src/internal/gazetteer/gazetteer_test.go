@@ -0,0 +1,62 @@
+package gazetteer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		text string
+		want Location
+	}{
+		{"Lake Tekapo, New Zealand", Location{Country: "New Zealand", Continent: "Oceania", Regions: []string{"Lake Tekapo"}}},
+		{"Yosemite, California, USA", Location{Country: "United States", Continent: "North America", Regions: []string{"Yosemite", "California"}}},
+		{"Victoria, BC", Location{Country: "Canada", Continent: "North America", Regions: []string{"British Columbia"}}},
+		{"Maroon Bells, CO", Location{Country: "United States", Continent: "North America", Regions: []string{"Colorado"}}},
+		{"Jordan Lake, North Carolina", Location{Country: "United States", Continent: "North America", Regions: []string{"North Carolina"}}},
+		{"Petra, Jordan", Location{Country: "Jordan", Continent: "Asia"}},
+		{"Savannah, Georgia", Location{}},
+		{"Savannah, Georgia, USA", Location{Country: "United States", Continent: "North America", Regions: []string{"Georgia (US)"}}},
+		{"Kazbegi, Georgia, Asia", Location{Continent: "Asia"}},
+		{"Mount Kazbek, Georgia, Russia border", Location{Country: "Russia", Continent: "Europe"}},
+		{"Arenal Volcano, Costa Rica, Central America", Location{Country: "Costa Rica", Continent: "North America"}},
+		{"Latin America sunset", Location{}},
+		{"Sunrise OR sunset", Location{}},
+		{"CO2 haze over the valley", Location{}},
+		{"Torres del Paine, Patagonia", Location{Country: "Chile", Continent: "South America", Regions: []string{"Torres del Paine", "Patagonia"}}},
+		{"Patagonia, South America", Location{Continent: "South America", Regions: []string{"Patagonia"}}},
+		{"Sunrise over the lake", Location{}},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			got := Lookup(test.text)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := map[string]string{
+		"usa":          "United States",
+		"nz":           "New Zealand",
+		"Georgia":      "Georgia",
+		"georgia (us)": "Georgia (US)",
+		"Colorado":     "Colorado",
+		"co":           "Colorado",
+	}
+	for name, want := range tests {
+		got, err := Canonical(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != want {
+			t.Fatalf("%s: got %s, want %s", name, got, want)
+		}
+	}
+	if _, err := Canonical("america"); err == nil {
+		t.Fatal("expected america to be unknown")
+	}
+}
@@ -0,0 +1,102 @@
+// Package listing_sources parses the sources backgrounds are fetched from, e.g. "earthporn", "r/earthporn",
+// "r/earthporn+skyporn", "user/spez/m/landscapes" or "user/spez/saved".
+package listing_sources
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindSubreddit   Kind = "subreddit"
+	KindMultireddit Kind = "multireddit"
+	KindSaved       Kind = "saved"
+	KindUpvoted     Kind = "upvoted"
+	// KindPosts looks up specific posts, it's used to download posts again and can't be parsed
+	KindPosts Kind = "posts"
+)
+
+var (
+	subredditPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_]{1,20}$`)
+	usernamePattern  = regexp.MustCompile(`^[A-Za-z0-9_-]{3,20}$`)
+	multiPattern     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_]{1,49}$`)
+)
+
+type Source struct {
+	Kind Kind
+	// Subreddit may combine several subreddits with '+', e.g. earthporn+skyporn
+	Subreddit string
+	Username  string
+	// Multireddit is the name of the user's multireddit (custom feed)
+	Multireddit string
+	// PostIDs are the full names of posts, e.g. t3_abc
+	PostIDs []string
+}
+
+func Parse(raw string) (Source, error) {
+	parts := strings.Split(strings.Trim(strings.TrimSpace(raw), "/"), "/")
+	switch {
+	case len(parts) == 1 && isSubreddit(parts[0]):
+		return Source{Kind: KindSubreddit, Subreddit: parts[0]}, nil
+	case len(parts) == 2 && parts[0] == "r" && isSubreddit(parts[1]):
+		return Source{Kind: KindSubreddit, Subreddit: parts[1]}, nil
+	case len(parts) == 4 && isUserPrefix(parts[0]) && usernamePattern.MatchString(parts[1]) && parts[2] == "m" &&
+		multiPattern.MatchString(parts[3]):
+		return Source{Kind: KindMultireddit, Username: parts[1], Multireddit: parts[3]}, nil
+	case len(parts) == 3 && isUserPrefix(parts[0]) && usernamePattern.MatchString(parts[1]):
+		switch Kind(parts[2]) {
+		case KindSaved, KindUpvoted:
+			return Source{Kind: Kind(parts[2]), Username: parts[1]}, nil
+		}
+	}
+	return Source{}, fmt.Errorf("'%s' is not a valid source, expected a subreddit such as r/earthporn, combined subreddits such as r/earthporn+skyporn, a multireddit such as user/{name}/m/{multireddit}, user/{name}/saved or user/{name}/upvoted", raw)
+}
+
+// isSubreddit accepts a single subreddit name or several joined with '+'
+func isSubreddit(name string) bool {
+	for _, subreddit := range strings.Split(name, "+") {
+		if !subredditPattern.MatchString(subreddit) {
+			return false
+		}
+	}
+	return true
+}
+
+func isUserPrefix(part string) bool {
+	return part == "user" || part == "u"
+}
+
+// RequiresUser is true for sources which can only be read with a logged in user's token
+func (source Source) RequiresUser() bool {
+	return source.Kind == KindSaved || source.Kind == KindUpvoted
+}
+
+// Path is the listing path relative to the reddit API endpoint, sortType only applies to subreddits and multireddits
+func (source Source) Path(sortType string) string {
+	switch source.Kind {
+	case KindMultireddit:
+		return "/user/" + source.Username + "/m/" + source.Multireddit + "/" + sortType
+	case KindSaved, KindUpvoted:
+		return "/user/" + source.Username + "/" + string(source.Kind)
+	case KindPosts:
+		return "/by_id/" + strings.Join(source.PostIDs, ",")
+	default:
+		return "/r/" + source.Subreddit + "/" + sortType
+	}
+}
+
+func (source Source) String() string {
+	switch source.Kind {
+	case KindMultireddit:
+		return "user/" + source.Username + "/m/" + source.Multireddit
+	case KindSaved, KindUpvoted:
+		return "user/" + source.Username + "/" + string(source.Kind)
+	case KindPosts:
+		return "by_id"
+	default:
+		return "r/" + source.Subreddit
+	}
+}
@@ -0,0 +1,180 @@
+package local_api
+
+import (
+	"crypto/rand"
+	"earthpullr/internal/reddit_cli"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// maxFinishedJobs are kept for their status to be polled, older ones are forgotten
+const maxFinishedJobs = 20
+
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Types of the server-sent events of a job
+const (
+	eventProgress = "progress"
+	eventFinished = "finished"
+)
+
+type JobStatus struct {
+	ID         string                        `json:"id"`
+	State      string                        `json:"state"`
+	Request    reddit_cli.BackgroundsRequest `json:"request"`
+	Summary    *reddit_cli.RunSummary        `json:"summary,omitempty"`
+	Error      string                        `json:"error,omitempty"`
+	StartedAt  time.Time                     `json:"started_at"`
+	FinishedAt *time.Time                    `json:"finished_at,omitempty"`
+}
+
+type jobEvent struct {
+	Type string
+	Data interface{}
+}
+
+type job struct {
+	mu     sync.Mutex
+	status JobStatus
+	events []jobEvent
+	// changed is closed and replaced whenever an event is added
+	changed chan struct{}
+}
+
+func (j *job) snapshot() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+func (j *job) addEvent(event jobEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.events = append(j.events, event)
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// eventsFrom returns the events after the first from, a channel closed when there are more and whether the job has
+// finished
+func (j *job) eventsFrom(from int) ([]jobEvent, <-chan struct{}, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var events []jobEvent
+	if from < len(j.events) {
+		events = append(events, j.events[from:]...)
+	}
+	return events, j.changed, j.status.State != JobRunning
+}
+
+func (j *job) finish(summary reddit_cli.RunSummary, err error) {
+	j.mu.Lock()
+	finishedAt := time.Now().UTC()
+	j.status.FinishedAt = &finishedAt
+	j.status.Summary = &summary
+	j.status.State = JobSucceeded
+	if err != nil {
+		j.status.State = JobFailed
+		j.status.Error = err.Error()
+	}
+	status := j.status
+	j.mu.Unlock()
+	j.addEvent(jobEvent{Type: eventFinished, Data: status})
+}
+
+type jobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []string
+}
+
+func newJobs() *jobs {
+	return &jobs{jobs: map[string]*job{}}
+}
+
+// start records a job then begins its fetch with startFetch, which runs it in the background. Recording it first means
+// events and finishing from a fetch which ends straight away go to a job which can already be looked up, the job is
+// removed again if the fetch didn't start
+func (js *jobs) start(request reddit_cli.BackgroundsRequest, startFetch func(reddit_cli.BackgroundsRequest, func(reddit_cli.ProgressEvent), func(reddit_cli.RunSummary, error)) error) (JobStatus, error) {
+	id, err := newJobID()
+	if err != nil {
+		return JobStatus{}, err
+	}
+	j := &job{
+		status:  JobStatus{ID: id, State: JobRunning, Request: request, StartedAt: time.Now().UTC()},
+		changed: make(chan struct{}),
+	}
+	js.mu.Lock()
+	js.jobs[id] = j
+	js.order = append(js.order, id)
+	js.mu.Unlock()
+	err = startFetch(request, func(event reddit_cli.ProgressEvent) {
+		j.addEvent(jobEvent{Type: eventProgress, Data: event})
+	}, j.finish)
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if err != nil {
+		js.remove(id)
+		return JobStatus{}, err
+	}
+	js.forgetOldJobs()
+	return j.snapshot(), nil
+}
+
+// remove forgets the job with the id, the caller must hold js.mu
+func (js *jobs) remove(id string) {
+	delete(js.jobs, id)
+	for i, recorded := range js.order {
+		if recorded == id {
+			js.order = append(js.order[:i], js.order[i+1:]...)
+			return
+		}
+	}
+}
+
+func (js *jobs) forgetOldJobs() {
+	finished := 0
+	for i := len(js.order) - 1; i >= 0; i-- {
+		id := js.order[i]
+		if js.jobs[id].snapshot().State == JobRunning {
+			continue
+		}
+		finished++
+		if finished > maxFinishedJobs {
+			delete(js.jobs, id)
+			js.order = append(js.order[:i], js.order[i+1:]...)
+		}
+	}
+}
+
+func (js *jobs) get(id string) (*job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.jobs[id]
+	return j, ok
+}
+
+// list returns the status of every job, newest first
+func (js *jobs) list() []JobStatus {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	statuses := []JobStatus{}
+	for i := len(js.order) - 1; i >= 0; i-- {
+		statuses = append(statuses, js.jobs[js.order[i]].snapshot())
+	}
+	return statuses
+}
+
+func newJobID() (string, error) {
+	idBytes := make([]byte, 8)
+	_, err := rand.Read(idBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(idBytes), nil
+}
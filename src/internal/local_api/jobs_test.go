@@ -0,0 +1,39 @@
+package local_api
+
+import (
+	"earthpullr/internal/reddit_cli"
+	"errors"
+	"testing"
+)
+
+func TestJobsStart(t *testing.T) {
+	js := newJobs()
+	status, err := js.start(reddit_cli.BackgroundsRequest{}, func(request reddit_cli.BackgroundsRequest, progress func(reddit_cli.ProgressEvent), finish func(reddit_cli.RunSummary, error)) error {
+		if running := js.list(); len(running) != 1 || running[0].State != JobRunning {
+			t.Fatalf("got jobs %+v while starting, want the starting job", running)
+		}
+		// A fetch which finishes before starting returns
+		finish(reddit_cli.RunSummary{}, nil)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, ok := js.get(status.ID)
+	if !ok {
+		t.Fatal("expected the started job to be recorded")
+	}
+	if state := j.snapshot().State; state == JobRunning {
+		t.Fatalf("got state %s, want the job to have finished", state)
+	}
+
+	_, err = js.start(reddit_cli.BackgroundsRequest{}, func(reddit_cli.BackgroundsRequest, func(reddit_cli.ProgressEvent), func(reddit_cli.RunSummary, error)) error {
+		return reddit_cli.ErrBusy
+	})
+	if !errors.Is(err, reddit_cli.ErrBusy) {
+		t.Fatalf("got error %v, want %v", err, reddit_cli.ErrBusy)
+	}
+	if statuses := js.list(); len(statuses) != 1 || statuses[0].ID != status.ID {
+		t.Fatalf("got jobs %+v, want only the job which started", statuses)
+	}
+}
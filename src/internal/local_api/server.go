@@ -0,0 +1,308 @@
+// Package local_api serves the background retriever as an HTTP/JSON API on a loopback address so window managers,
+// launchers and scripts can drive earthpullr. Every request must send the token stored at TokenPath as
+// "Authorization: Bearer <token>", event streams may pass it as the token query parameter instead as browsers can't
+// set headers on them.
+//
+//	GET  /api/v1/settings           the user settings
+//	PUT  /api/v1/settings           update the user settings, fields missing from the body are kept
+//	GET  /api/v1/jobs               the status of recent fetches, newest first
+//	POST /api/v1/jobs               start a fetch, fields missing from the BackgroundsRequest body use the last request
+//	GET  /api/v1/jobs/{id}          the status of a fetch
+//	GET  /api/v1/jobs/{id}/events   progress and finished server-sent events of a fetch
+//	GET  /api/v1/library?dir=       the downloaded backgrounds, dir defaults to the download path of the settings
+//	POST /api/v1/wallpaper          set the wallpaper to {"path": ...} or to a background picked with {"filters": {...}}
+//
+// Starting a fetch or updating the settings while another fetch, verification or import is running, including one
+// started from the frontend, responds with 409 Conflict.
+package local_api
+
+import (
+	"crypto/subtle"
+	"earthpullr/internal/config"
+	"earthpullr/internal/reddit_cli"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxBodyBytes = 1 << 20
+
+// keepAliveInterval stops proxies and clients timing out event streams while a fetch is between images
+const keepAliveInterval = 15 * time.Second
+
+type server struct {
+	logger    *zap.Logger
+	retriever *reddit_cli.BackgroundRetriever
+	token     string
+	jobs      *jobs
+}
+
+// StartServer serves the API on listenAddress in the background until the returned server is closed, the address must
+// be a loopback address as anyone who can reach it could download files and change the settings with the token
+func StartServer(listenAddress string, conf config.Config, retriever *reddit_cli.BackgroundRetriever, logger *zap.Logger) (*http.Server, error) {
+	err := checkLoopback(listenAddress)
+	if err != nil {
+		return nil, err
+	}
+	tokenPath, err := TokenPath(conf.ApplicationName, conf.ApiTokenFname)
+	if err != nil {
+		return nil, err
+	}
+	token, err := loadOrCreateToken(tokenPath)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on API address '%s': %v", listenAddress, err)
+	}
+	s := &server{logger: logger, retriever: retriever, token: token, jobs: newJobs()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/settings", s.handleSettings)
+	mux.HandleFunc("/api/v1/jobs", s.handleJobs)
+	mux.HandleFunc("/api/v1/jobs/", s.handleJob)
+	mux.HandleFunc("/api/v1/library", s.handleLibrary)
+	mux.HandleFunc("/api/v1/wallpaper", s.handleWallpaper)
+	httpServer := &http.Server{Handler: s.authenticate(mux)}
+	go func() {
+		err := httpServer.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("API server stopped", zap.Error(err))
+		}
+	}()
+	logger.Info(fmt.Sprintf("Serving the API on http://%s/api/v1/", listener.Addr()), zap.String("token_path", tokenPath))
+	return httpServer, nil
+}
+
+func checkLoopback(listenAddress string) error {
+	host, _, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return fmt.Errorf("invalid API address '%s': %v", listenAddress, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("API address '%s' must be a loopback address such as localhost:7878", listenAddress)
+}
+
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		token := ""
+		if strings.HasPrefix(authorization, "Bearer ") {
+			token = strings.TrimPrefix(authorization, "Bearer ")
+		} else if authorization == "" && strings.HasSuffix(r.URL.Path, "/events") {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid API token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, http.StatusOK, s.retriever.GetSettings())
+	case http.MethodPut:
+		body, ok := readJsonObject(w, r)
+		if !ok {
+			return
+		}
+		settings, err := s.retriever.UpdateSettings(body)
+		if err != nil {
+			writeRetrieverError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJson(w, http.StatusOK, settings)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, http.StatusOK, s.jobs.list())
+	case http.MethodPost:
+		body, ok := readJsonObject(w, r)
+		if !ok {
+			return
+		}
+		request := s.retriever.DefaultBackgroundsRequest()
+		err := mapstructure.Decode(body, &request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode backgrounds request: %v", err))
+			return
+		}
+		status, err := s.jobs.start(request, s.retriever.StartFetch)
+		if err != nil {
+			writeRetrieverError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Location", "/api/v1/jobs/"+status.ID)
+		writeJson(w, http.StatusAccepted, status)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/"), "/")
+	j, ok := s.jobs.get(parts[0])
+	if !ok || len(parts) > 2 || (len(parts) == 2 && parts[1] != "events") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job '%s'", strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/")))
+		return
+	}
+	if len(parts) == 1 {
+		writeJson(w, http.StatusOK, j.snapshot())
+		return
+	}
+	s.streamEvents(w, r, j)
+}
+
+// streamEvents sends every event of the job as server-sent events until it finishes, clients reconnecting with
+// Last-Event-ID only receive the events they missed
+func (s *server) streamEvents(w http.ResponseWriter, r *http.Request, j *job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	next := 0
+	if lastID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		next = lastID + 1
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		events, changed, finished := j.eventsFrom(next)
+		for _, event := range events {
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				s.logger.Error("Failed to marshall job event", zap.Error(err))
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", next, event.Type, data)
+			next++
+		}
+		flusher.Flush()
+		if finished {
+			return
+		}
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *server) handleLibrary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	library, err := s.retriever.ListLibrary(r.URL.Query().Get("dir"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, http.StatusOK, library)
+}
+
+type wallpaperRequest struct {
+	Path    string                 `json:"path"`
+	Filters map[string]interface{} `json:"filters"`
+}
+
+func (s *server) handleWallpaper(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var request wallpaperRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode wallpaper request: %v", err))
+		return
+	}
+	if request.Path == "" {
+		request.Path, err = s.retriever.PickBackground(request.Filters)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	err = s.retriever.SetWallpaper(request.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"path": request.Path})
+}
+
+func readJsonObject(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	body := map[string]interface{}{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("request body must be a JSON object: %v", err))
+		return nil, false
+	}
+	return body, true
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	body, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		zap.L().Error("Failed to marshall API response", zap.Error(err))
+		status = http.StatusInternalServerError
+		body = []byte(`{"error": "failed to encode the response"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(append(body, '\n'))
+	if err != nil {
+		zap.L().Debug("Failed to write API response", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeRetrieverError responds with a conflict when the retriever is in use, by the API or by the frontend
+func writeRetrieverError(w http.ResponseWriter, status int, err error) {
+	if errors.Is(err, reddit_cli.ErrBusy) {
+		status = http.StatusConflict
+	}
+	writeError(w, status, err)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed, use %s", strings.Join(allowed, " or ")))
+}
@@ -0,0 +1,77 @@
+package local_api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	s := &server{token: "secret"}
+	handler := s.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"bearer token", "/api/v1/settings", "Bearer secret", http.StatusOK},
+		{"token without scheme", "/api/v1/settings", "secret", http.StatusUnauthorized},
+		{"other scheme", "/api/v1/settings", "Basic secret", http.StatusUnauthorized},
+		{"wrong token", "/api/v1/settings", "Bearer wrong", http.StatusUnauthorized},
+		{"empty bearer", "/api/v1/settings", "Bearer ", http.StatusUnauthorized},
+		{"missing", "/api/v1/settings", "", http.StatusUnauthorized},
+		{"query token on events", "/api/v1/jobs/1/events?token=secret", "", http.StatusOK},
+		{"query token elsewhere", "/api/v1/settings?token=secret", "", http.StatusUnauthorized},
+		{"query token with invalid header", "/api/v1/jobs/1/events?token=secret", "secret", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != test.want {
+				t.Fatalf("got status %d, want %d", rec.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckLoopback(t *testing.T) {
+	for _, address := range []string{"localhost:7878", "127.0.0.1:0", "[::1]:7878"} {
+		if err := checkLoopback(address); err != nil {
+			t.Errorf("%s: %v", address, err)
+		}
+	}
+	for _, address := range []string{"0.0.0.0:7878", ":7878", "192.168.1.2:7878", "localhost"} {
+		if err := checkLoopback(address); err == nil {
+			t.Errorf("%s: expected an error", address)
+		}
+	}
+}
+
+func TestWriteJson(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		wantStatus int
+		wantBody   string
+	}{
+		{"encodable", map[string]int{"a": 1}, http.StatusOK, "{\n  \"a\": 1\n}\n"},
+		{"unencodable", map[string]interface{}{"a": make(chan int)}, http.StatusInternalServerError, "{\"error\": \"failed to encode the response\"}\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeJson(rec, http.StatusOK, test.value)
+			if rec.Code != test.wantStatus || rec.Body.String() != test.wantBody {
+				t.Fatalf("got status %d and body '%s', want %d and '%s'", rec.Code, rec.Body.String(), test.wantStatus, test.wantBody)
+			}
+		})
+	}
+}
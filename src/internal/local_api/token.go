@@ -0,0 +1,46 @@
+package local_api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TokenPath is where the token clients must send as "Authorization: Bearer <token>" is stored
+func TokenPath(applicationName string, tokenFname string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, applicationName, tokenFname), nil
+}
+
+// loadOrCreateToken generates a random token the first time the API is served, the file is only readable by the user
+func loadOrCreateToken(fpath string) (string, error) {
+	byteValue, err := ioutil.ReadFile(fpath)
+	if err == nil && strings.TrimSpace(string(byteValue)) != "" {
+		return strings.TrimSpace(string(byteValue)), nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read API token: %v", err)
+	}
+	tokenBytes := make([]byte, 32)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate API token: %v", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+	err = os.MkdirAll(filepath.Dir(fpath), 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create API token directory: %v", err)
+	}
+	err = ioutil.WriteFile(fpath, []byte(token+"\n"), 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to save API token: %v", err)
+	}
+	return token, nil
+}
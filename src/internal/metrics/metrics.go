@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "earthpullr"
+
+// StatusError is used as the status label when no HTTP response was received
+const StatusError = "error"
+
+var (
+	ListingRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "listing_requests_total",
+		Help:      "Reddit listing requests by source and response status.",
+	}, []string{"source", "status"})
+
+	ListingRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "listing_request_duration_seconds",
+		Help:      "Latency of reddit listing requests including retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source"})
+
+	OAuthTokenFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "oauth_token_fetches_total",
+		Help:      "Reddit OAuth token requests by grant type and response status.",
+	}, []string{"grant_type", "status"})
+
+	OAuthTokenFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "oauth_token_fetch_duration_seconds",
+		Help:      "Latency of reddit OAuth token requests including retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"grant_type"})
+
+	ImageDownloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_downloads_total",
+		Help:      "Image downloads by source, subreddit and response status.",
+	}, []string{"source", "subreddit", "status"})
+
+	ImageDownloadBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_download_bytes_total",
+		Help:      "Bytes of image data saved to disk.",
+	}, []string{"source", "subreddit"})
+
+	ImageDownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_download_duration_seconds",
+		Help:      "Time taken to download and save an image.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"source", "subreddit"})
+
+	ImageRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_rejections_total",
+		Help:      "Listing images rejected before download by filter reason.",
+	}, []string{"source", "subreddit", "reason"})
+
+	HTTPRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_retries_total",
+		Help:      "Retried HTTP requests by component and retry reason.",
+	}, []string{"component", "reason"})
+
+	RateLimitWaits = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_wait_seconds",
+		Help:      "Time spent waiting after being rate limited.",
+		Buckets:   []float64{1, 2, 5, 10, 30, 60},
+	}, []string{"component"})
+)
@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"earthpullr/pkg/http_retry"
+	"strconv"
+	"time"
+)
+
+// RetryObserver records retries and rate limit waits for the given component, e.g. "listing"
+func RetryObserver(component string) http_retry.Observer {
+	return http_retry.Observer{
+		OnRetry: func(reason string) {
+			HTTPRetries.WithLabelValues(component, reason).Inc()
+		},
+		OnRateLimitWait: func(wait time.Duration) {
+			RateLimitWaits.WithLabelValues(component).Observe(wait.Seconds())
+		},
+	}
+}
+
+// Status converts an HTTP response status code into a label value
+func Status(statusCode int, err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return strconv.Itoa(statusCode)
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// StartServer serves /metrics on listenAddress in the background until the returned server is closed
+func StartServer(listenAddress string, logger *zap.Logger) (*http.Server, error) {
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on metrics address '%s': %v", listenAddress, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Handler: mux}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server stopped", zap.Error(err))
+		}
+	}()
+	logger.Info(fmt.Sprintf("Serving metrics on http://%s/metrics", listener.Addr()))
+	return server, nil
+}
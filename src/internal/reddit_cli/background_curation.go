@@ -0,0 +1,144 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/curation"
+	"earthpullr/pkg/image_hash"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// postIDFromPath returns the reddit post ID of a downloaded background, these are saved as {post ID}.{extension}
+func postIDFromPath(fpath string) (string, error) {
+	fname := filepath.Base(fpath)
+	postID := strings.TrimSuffix(fname, filepath.Ext(fname))
+	if !strings.HasPrefix(postID, "t3_") || len(postID) <= len("t3_") {
+		return "", fmt.Errorf("'%s' is not a background downloaded by earthpullr", fpath)
+	}
+	return postID, nil
+}
+
+func (br *BackgroundRetriever) FavouriteBackground(fpath string) error {
+	postID, err := postIDFromPath(fpath)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(fpath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of '%s': %v", fpath, err)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return fmt.Errorf("failed to favourite '%s': %v", fpath, err)
+	}
+	err = br.curation.AddFavourite(postID, absPath)
+	if err != nil {
+		return fmt.Errorf("failed to favourite '%s': %v", fpath, err)
+	}
+	br.logger.Info("Added favourite background", zap.String("post_id", postID), zap.String("path", absPath))
+	return nil
+}
+
+func (br *BackgroundRetriever) UnfavouriteBackground(fpath string) error {
+	postID, err := postIDFromPath(fpath)
+	if err != nil {
+		return err
+	}
+	err = br.curation.RemoveFavourite(postID)
+	if err != nil {
+		return fmt.Errorf("failed to remove favourite '%s': %v", fpath, err)
+	}
+	br.logger.Info("Removed favourite background", zap.String("post_id", postID))
+	return nil
+}
+
+func (br *BackgroundRetriever) GetFavourites() []curation.Favourite {
+	return br.curation.Favourites()
+}
+
+// ExportFavourites writes the favourites to fpath in either the text or json format
+func (br *BackgroundRetriever) ExportFavourites(fpath string, format string) error {
+	file, err := os.Create(fpath)
+	if err != nil {
+		return fmt.Errorf("failed to create favourites export '%s': %v", fpath, err)
+	}
+	defer file.Close()
+	err = br.curation.ExportFavourites(file, format)
+	if err != nil {
+		return fmt.Errorf("failed to export favourites: %v", err)
+	}
+	br.logger.Info(fmt.Sprintf("Exported favourites to '%s'", fpath))
+	return nil
+}
+
+// BanBackground deletes the background and stops both its post and any repost of the image being downloaded again.
+// The download directory is locked while it's removed from the directory's index.
+func (br *BackgroundRetriever) BanBackground(fpath string) error {
+	postID, err := postIDFromPath(fpath)
+	if err != nil {
+		return err
+	}
+	if br.curation.IsFavourite(postID) {
+		return fmt.Errorf("'%s' is a favourite, remove it from the favourites before banning it", fpath)
+	}
+	err = br.acquire()
+	if err != nil {
+		return err
+	}
+	defer br.release()
+	downloadPath := filepath.Dir(fpath)
+	lock, err := br.lockDownloadPath(downloadPath, false)
+	if err != nil {
+		return err
+	}
+	defer br.unlockDownloadPath(lock)
+	var hash *image_hash.Hash
+	imageHash, err := image_hash.DHashFile(fpath)
+	if err != nil {
+		// The post is still banned, only reposts of it will not be recognised
+		br.logger.Warn(fmt.Sprintf("Failed to hash banned background '%s'", fpath), zap.Error(err))
+	} else {
+		hash = &imageHash
+	}
+	err = br.curation.BanPost(postID, hash)
+	if err != nil {
+		return fmt.Errorf("failed to ban '%s': %v", fpath, err)
+	}
+	err = os.Remove(fpath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("banned '%s' but failed to delete it: %v", fpath, err)
+	}
+	err = os.Remove(SidecarPath(fpath))
+	if err != nil && !os.IsNotExist(err) {
+		br.logger.Warn(fmt.Sprintf("Failed to delete the metadata sidecar of '%s'", fpath), zap.Error(err))
+	}
+	existingBackgrounds := NewExistingBackgrounds(downloadPath, br.conf.ExistingImagesFilename, br.logger)
+	if existingBackgrounds.HasBackground(filepath.Base(fpath)) {
+		existingBackgrounds.RemoveBackground(filepath.Base(fpath))
+		err = existingBackgrounds.SaveExistingBackgrounds()
+		if err != nil {
+			return fmt.Errorf("banned and deleted '%s' but failed to remove it from the index: %v", fpath, err)
+		}
+	}
+	br.logger.Info("Banned background", zap.String("post_id", postID), zap.Bool("repost_detection", hash != nil))
+	return nil
+}
+
+func (br *BackgroundRetriever) BanAuthor(author string) error {
+	err := br.curation.BanAuthor(author)
+	if err != nil {
+		return fmt.Errorf("failed to ban author: %v", err)
+	}
+	br.logger.Info("Banned author", zap.String("author", author))
+	return nil
+}
+
+func (br *BackgroundRetriever) BanDomain(domain string) error {
+	err := br.curation.BanDomain(domain)
+	if err != nil {
+		return fmt.Errorf("failed to ban domain: %v", err)
+	}
+	br.logger.Info("Banned domain", zap.String("domain", domain))
+	return nil
+}
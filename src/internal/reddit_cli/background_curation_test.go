@@ -0,0 +1,35 @@
+package reddit_cli
+
+import (
+	"earthpullr/pkg/mock_reddit"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestBanBackgroundRemovesItFromTheIndex(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	_, err := retriever.FetchBackgrounds(testRequest(downloadPath, 2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := savedImages(t, downloadPath)
+	banned := filepath.Join(downloadPath, images[0])
+
+	err = retriever.BanBackground(banned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(banned); !os.IsNotExist(err) {
+		t.Fatalf("expected '%s' to be deleted, got %v", banned, err)
+	}
+	index := NewExistingBackgrounds(downloadPath, retriever.conf.ExistingImagesFilename, zap.NewNop())
+	if index.HasBackground(images[0]) || !index.HasBackground(images[1]) {
+		t.Fatalf("expected only '%s' to be indexed, got %v", images[1], index.Backgrounds())
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, retriever.conf.DownloadLockFilename)); !os.IsNotExist(err) {
+		t.Fatalf("expected the download directory lock to be released, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/user_settings"
+	"earthpullr/pkg/dir_lock"
+	"earthpullr/pkg/image_colour"
+	"earthpullr/pkg/image_format"
+	"earthpullr/pkg/wallpaper"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var pickerRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// PickBackground chooses a random downloaded background from the last used download path matching the location,
+// brightness and colour filters, so the backgrounds being rotated through can follow the time of day or the system theme.
+// Backgrounds downloaded before colours were analysed are analysed on demand.
+func (br *BackgroundRetriever) PickBackground(request map[string]interface{}) (string, error) {
+	var filters user_settings.Filters
+	err := mapstructure.Decode(request, &filters)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode background filters from frontend: %v", err)
+	}
+	downloadPath := br.settings().DownloadPath
+	if downloadPath == "" {
+		return "", fmt.Errorf("no backgrounds have been downloaded yet")
+	}
+	return br.pickBackground(downloadPath, filters)
+}
+
+// SetWallpaper uses a background as the desktop wallpaper
+func (br *BackgroundRetriever) SetWallpaper(fpath string) error {
+	err := wallpaper.Set(fpath)
+	if err != nil {
+		return err
+	}
+	br.logger.Info(fmt.Sprintf("Set the wallpaper to '%s'", fpath))
+	return nil
+}
+
+// PickWallpaper picks a background like PickBackground and uses it as the desktop wallpaper
+func (br *BackgroundRetriever) PickWallpaper(request map[string]interface{}) (string, error) {
+	fpath, err := br.PickBackground(request)
+	if err != nil {
+		return "", err
+	}
+	return fpath, br.SetWallpaper(fpath)
+}
+
+func (br *BackgroundRetriever) pickBackground(downloadPath string, filters user_settings.Filters) (string, error) {
+	filter, err := newColourFilter(filters)
+	if err != nil {
+		return "", err
+	}
+	locationFilter, err := newLocationFilter(filters)
+	if err != nil {
+		return "", err
+	}
+	existingBackgrounds := NewExistingBackgrounds(downloadPath, br.conf.ExistingImagesFilename, br.logger)
+	backgrounds := existingBackgrounds.Backgrounds()
+	var fnames []string
+	for fname := range backgrounds {
+		fnames = append(fnames, fname)
+	}
+	sort.Strings(fnames)
+
+	var matches []string
+	analyses := map[string]image_colour.Analysis{}
+	for _, fname := range fnames {
+		fpath := filepath.Join(downloadPath, fname)
+		if _, err := os.Stat(fpath); err != nil {
+			continue
+		}
+		metadata := backgrounds[fname]
+		if metadata.PostID != "" && br.curation.IsBannedPost(metadata.PostID) {
+			continue
+		}
+		location := metadata.Location
+		if location == nil {
+			location = titleLocation(metadata.TitleMetadata)
+		}
+		if locationFilter.rejectionReason(br.logger, fname, location) != "" {
+			continue
+		}
+		if metadata.Colour == nil {
+			img, _, err := image_format.DecodeFile(fpath)
+			if err != nil {
+				br.logger.Warn(fmt.Sprintf("Failed to analyse the colours of '%s'", fpath), zap.Error(err))
+				continue
+			}
+			analysis := image_colour.Analyse(img)
+			metadata.Colour = &analysis
+			analyses[fname] = analysis
+		}
+		if filter.rejectionReason(br.logger, fname, *metadata.Colour) == "" {
+			matches = append(matches, fpath)
+		}
+	}
+	if len(analyses) > 0 {
+		br.saveColourAnalysis(downloadPath, analyses)
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("none of the %d backgrounds in '%s' match the filters", len(fnames), downloadPath)
+	}
+	return matches[pickerRand.Intn(len(matches))], nil
+}
+
+// saveColourAnalysis merges the analyses into the index, reloading it under the lock so backgrounds indexed or removed
+// since it was read aren't lost or brought back. It's skipped while another run is using the download path, the
+// backgrounds are analysed again next time.
+func (br *BackgroundRetriever) saveColourAnalysis(downloadPath string, analyses map[string]image_colour.Analysis) {
+	lock, err := dir_lock.Acquire(downloadPath, br.conf.DownloadLockFilename)
+	if err != nil {
+		br.logger.Info("Not saving the colour analysis of existing backgrounds", zap.Error(err))
+		return
+	}
+	defer br.unlockDownloadPath(lock)
+	existingBackgrounds := NewExistingBackgrounds(downloadPath, br.conf.ExistingImagesFilename, br.logger)
+	for fname, analysis := range analyses {
+		metadata, ok := existingBackgrounds.GetBackground(fname)
+		if !ok || metadata.Colour != nil {
+			continue
+		}
+		analysis := analysis
+		metadata.Colour = &analysis
+		existingBackgrounds.AddBackground(fname, metadata)
+	}
+	err = existingBackgrounds.SaveExistingBackgrounds()
+	if err != nil {
+		br.logger.Warn("Failed to save the colour analysis of existing backgrounds", zap.Error(err))
+	}
+}
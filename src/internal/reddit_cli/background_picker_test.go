@@ -0,0 +1,82 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/user_settings"
+	"earthpullr/pkg/image_colour"
+	"earthpullr/pkg/mock_reddit"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// forgetColours removes the colour analysis from the index like backgrounds downloaded before it was added
+func forgetColours(t *testing.T, retriever *BackgroundRetriever, downloadPath string) *ExistingBackgrounds {
+	t.Helper()
+	index := NewExistingBackgrounds(downloadPath, retriever.conf.ExistingImagesFilename, zap.NewNop())
+	for fname, metadata := range index.Backgrounds() {
+		metadata.Colour = nil
+		index.AddBackground(fname, metadata)
+	}
+	err := index.SaveExistingBackgrounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestPickBackgroundAnalysesColours(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	_, err := retriever.FetchBackgrounds(testRequest(downloadPath, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgetColours(t, retriever, downloadPath)
+
+	_, err = retriever.pickBackground(downloadPath, user_settings.Filters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewExistingBackgrounds(downloadPath, retriever.conf.ExistingImagesFilename, zap.NewNop())
+	for fname, metadata := range index.Backgrounds() {
+		if metadata.Colour == nil {
+			t.Fatalf("expected the colours of '%s' to be saved", fname)
+		}
+	}
+}
+
+func TestSaveColourAnalysisMergesIntoTheCurrentIndex(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	_, err := retriever.FetchBackgrounds(testRequest(downloadPath, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := forgetColours(t, retriever, downloadPath)
+	fnames := savedImages(t, downloadPath)
+	analyses := map[string]image_colour.Analysis{}
+	for _, fname := range fnames {
+		analyses[fname] = image_colour.Analysis{MeanLuminance: 0.5}
+	}
+
+	// Another run indexes a background and removes one while the colours are analysed
+	index.AddBackground("t3_new.jpg", BackgroundMetadata{PostID: "t3_new"})
+	index.RemoveBackground(fnames[0])
+	err = index.SaveExistingBackgrounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	retriever.saveColourAnalysis(downloadPath, analyses)
+
+	index = NewExistingBackgrounds(downloadPath, retriever.conf.ExistingImagesFilename, zap.NewNop())
+	if !index.HasBackground("t3_new.jpg") {
+		t.Fatal("lost the background indexed by the other run")
+	}
+	if index.HasBackground(fnames[0]) {
+		t.Fatalf("brought back '%s' removed by the other run", fnames[0])
+	}
+	for _, fname := range fnames[1:] {
+		metadata, _ := index.GetBackground(fname)
+		if metadata.Colour == nil || metadata.Colour.MeanLuminance != 0.5 {
+			t.Fatalf("expected the colours of '%s' to be saved, got %+v", fname, metadata.Colour)
+		}
+	}
+}
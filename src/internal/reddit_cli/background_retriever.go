@@ -3,17 +3,30 @@ package reddit_cli
 import (
 	"context"
 	"earthpullr/internal/config"
+	"earthpullr/internal/curation"
+	"earthpullr/internal/listing_sources"
 	"earthpullr/internal/reddit_oauth"
 	"earthpullr/internal/user_settings"
+	"earthpullr/pkg/bandwidth"
+	"earthpullr/pkg/dir_lock"
+	"earthpullr/pkg/http_client"
+	"earthpullr/pkg/http_retry"
+	"errors"
 	"fmt"
 	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/browser"
 	"github.com/wailsapp/wails"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
+// ErrBusy is returned when a fetch, verification, import or settings update is started while another is running, they
+// share the user settings and may share a download directory
+var ErrBusy = errors.New("earthpullr is busy retrieving backgrounds or updating the library, wait for it to finish")
+
 type BackgroundRetriever struct {
 	logger                     *zap.Logger
 	conf                       config.Config
@@ -21,6 +34,17 @@ type BackgroundRetriever struct {
 	ctx                        context.Context
 	client                     *http.Client
 	userSettingsMan            user_settings.UserSettingsManager
+	bandwidthLimiter           *bandwidth.Limiter
+	meteredBandwidthLimiter    *bandwidth.Limiter
+	tokenStore                 reddit_oauth.TokenStore
+	curation                   *curation.Manager
+	hooks                      *downloadHooks
+	notifier                   *runNotifier
+	// busy is set while a fetch, verification, import or settings update is running, as the frontend and the local API
+	// may call the retriever at the same time
+	mu                         sync.Mutex
+	busy                       bool
+	settingsMu                 sync.RWMutex
 }
 
 type BackgroundsRequest struct {
@@ -28,19 +52,53 @@ type BackgroundsRequest struct {
 	Height         int
 	BackgroundsCount int
 	DownloadPath   string
+	Sources        []string
+	Filters        user_settings.Filters
+	// Metered applies the metered bandwidth limit instead of the default one
+	Metered        bool
+	OutputFormat   string
+	JPEGQuality    int
+	// WaitForLock waits for another run using the download path to finish instead of failing
+	WaitForLock    bool
+	// DryRun returns the backgrounds which would be saved as candidates without saving them, the index or the settings
+	DryRun         bool
 }
 
 func NewBackgroundRetriever(ctx context.Context, logger *zap.Logger, conf config.Config) (*BackgroundRetriever, error) {
-	userSettingsMan, err := user_settings.NewUserSettingsManager(conf.UserSettingsFname)
+	userSettingsMan, err := user_settings.NewUserSettingsManager(conf.ApplicationName, conf.UserSettingsFname)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve saved settings: %v", err)
 	}
+	client, err := http_client.New(http_client.Options{
+		Timeout:        time.Duration(conf.HttpTimeoutSecs) * time.Second,
+		ProxyURL:       conf.HttpProxyUrl,
+		CABundlePaths:  conf.HttpCaBundlePaths,
+		ClientCertPath: conf.HttpClientCertPath,
+		ClientKeyPath:  conf.HttpClientKeyPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client: %v", err)
+	}
+	tokenStore, err := reddit_oauth.NewFileTokenStore(conf.ApplicationName, conf.RedditLoginFname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reddit login store: %v", err)
+	}
+	curationMan, err := curation.NewManager(conf.ApplicationName, conf.CurationFname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve favourites and bans: %v", err)
+	}
 	retriever := &BackgroundRetriever{
 		logger:                     logger,
 		conf:                       conf,
 		ctx:                        ctx,
-		client:                     &http.Client{Timeout: 10 * time.Second},
+		client:                     client,
 		userSettingsMan: 				userSettingsMan,
+		bandwidthLimiter:           bandwidth.NewLimiter(conf.BandwidthLimitBytesPerSec),
+		meteredBandwidthLimiter:    bandwidth.NewLimiter(conf.MeteredBandwidthLimitBytesPerSec),
+		tokenStore:                 tokenStore,
+		curation:                   curationMan,
+		hooks:                      newDownloadHooks(logger, conf),
+		notifier:                   newRunNotifier(logger, conf),
 	}
 	return retriever, nil
 }
@@ -50,20 +108,139 @@ func (br *BackgroundRetriever) WailsInit(runtime *wails.Runtime) error {
 	return nil
 }
 
-func (br *BackgroundRetriever) GetUserDownloadPath() string {
-	br.logger.Debug("Retrieved download path: " + br.userSettingsMan.Settings.DownloadPath)
-	return br.userSettingsMan.Settings.DownloadPath
+// acquire marks the retriever as in use, returning ErrBusy if it already is
+func (br *BackgroundRetriever) acquire() error {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if br.busy {
+		return ErrBusy
+	}
+	br.busy = true
+	return nil
+}
+
+func (br *BackgroundRetriever) release() {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.busy = false
+}
+
+func (br *BackgroundRetriever) settings() user_settings.UserSettings {
+	br.settingsMu.RLock()
+	defer br.settingsMu.RUnlock()
+	return br.userSettingsMan.Settings
+}
+
+func (br *BackgroundRetriever) updateSettings(settings user_settings.UserSettings) error {
+	br.settingsMu.Lock()
+	defer br.settingsMu.Unlock()
+	return br.userSettingsMan.UpdateUserSettings(settings)
+}
+
+func (br *BackgroundRetriever) GetSettings() user_settings.UserSettings {
+	settings := br.settings()
+	br.logger.Debug("Retrieved user settings", zap.Any("settings", settings))
+	return settings
+}
+
+func (br *BackgroundRetriever) UpdateSettings(settings map[string]interface{}) (user_settings.UserSettings, error) {
+	err := br.acquire()
+	if err != nil {
+		return br.settings(), err
+	}
+	defer br.release()
+	newSettings := br.settings()
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{ZeroFields: true, Result: &newSettings})
+	if err != nil {
+		return br.settings(), err
+	}
+	err = decoder.Decode(settings)
+	if err != nil {
+		return br.settings(), fmt.Errorf("failed to decode user settings from frontend: %v", err)
+	}
+	err = br.updateSettings(newSettings)
+	if err != nil {
+		return br.settings(), err
+	}
+	br.logger.Info("Updated user settings", zap.Any("settings", newSettings))
+	return br.settings(), nil
 }
 
-func (br *BackgroundRetriever) GetBackgrounds(request map[string]interface{}) (string, error) {
+func (br *BackgroundRetriever) GetBackgrounds(request map[string]interface{}) (RunSummary, error) {
 	var brRequest BackgroundsRequest
 	err := mapstructure.Decode(request, &brRequest)
 	if err != nil {
-		return "Error", fmt.Errorf("failed to decode backgrounds request from frontend: %v", err)
+		return RunSummary{}, fmt.Errorf("failed to decode backgrounds request from frontend: %v", err)
+	}
+	return br.FetchBackgrounds(brRequest, nil)
+}
+
+// DefaultBackgroundsRequest is the last used request saved to the user settings
+func (br *BackgroundRetriever) DefaultBackgroundsRequest() BackgroundsRequest {
+	settings := br.settings()
+	return BackgroundsRequest{
+		Width:            settings.Width,
+		Height:           settings.Height,
+		BackgroundsCount: settings.BackgroundsCount,
+		DownloadPath:     settings.DownloadPath,
+		Sources:          settings.Sources,
+		Filters:          settings.Filters,
+		OutputFormat:     settings.OutputFormat,
+		JPEGQuality:      settings.JPEGQuality,
+	}
+}
+
+// FetchBackgrounds is GetBackgrounds for callers other than the frontend, progress is called after each saved image
+// and may be nil
+func (br *BackgroundRetriever) FetchBackgrounds(brRequest BackgroundsRequest, progress func(ProgressEvent)) (RunSummary, error) {
+	err := br.acquire()
+	if err != nil {
+		return RunSummary{}, err
+	}
+	defer br.release()
+	return br.fetchBackgrounds(brRequest, progress)
+}
+
+// StartFetch runs FetchBackgrounds in the background, calling done once it finishes. ErrBusy is returned straight away
+// if the retriever is in use.
+func (br *BackgroundRetriever) StartFetch(brRequest BackgroundsRequest, progress func(ProgressEvent), done func(RunSummary, error)) error {
+	err := br.acquire()
+	if err != nil {
+		return err
 	}
+	go func() {
+		summary, err := br.fetchBackgrounds(brRequest, progress)
+		br.release()
+		done(summary, err)
+	}()
+	return nil
+}
+
+func (br *BackgroundRetriever) fetchBackgrounds(brRequest BackgroundsRequest, progress func(ProgressEvent)) (RunSummary, error) {
+	var err error
 	if _, dirErr := os.Stat(brRequest.DownloadPath); os.IsNotExist(dirErr) {
-		return "Error", fmt.Errorf("Download path '%s' does not exist", brRequest.DownloadPath)
+		return RunSummary{}, fmt.Errorf("Download path '%s' does not exist", brRequest.DownloadPath)
+	}
+	if len(brRequest.Sources) == 0 {
+		brRequest.Sources = []string{br.conf.Subreddit}
 	}
+	sources, err := br.parseSources(brRequest.Sources)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	if !brRequest.DryRun {
+		lock, err := br.lockDownloadPath(brRequest.DownloadPath, brRequest.WaitForLock)
+		if err != nil {
+			return RunSummary{}, err
+		}
+		defer br.unlockDownloadPath(lock)
+	}
+	existingBackgrounds := NewExistingBackgrounds(brRequest.DownloadPath, br.conf.ExistingImagesFilename, br.logger)
+	run, err := br.newRun(brRequest, existingBackgrounds)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	run.progress = progress
 	br.logger.Info(fmt.Sprintf(
 		"Received a request to retrieve %d backgrounds with a minimum resolution of %dx%d to directory %s",
 		brRequest.BackgroundsCount,
@@ -71,67 +248,238 @@ func (br *BackgroundRetriever) GetBackgrounds(request map[string]interface{}) (s
 		brRequest.Height,
 		brRequest.DownloadPath,
 	))
-	err = br.addOAuthTokenToCtx()
+	ctx, err := br.oauthContext()
 	if err != nil {
-		return "Error", fmt.Errorf("failed to get new backgrounds: %v", err)
+		err = fmt.Errorf("failed to get new backgrounds: %w", err)
+	} else {
+		err = br.getBackgroundsWithBatching(ctx, run, sources)
+	}
+	if !brRequest.DryRun {
+		run.hooks.runFinishedHook(br.ctx, run, err)
+		br.notifier.runFinished(run, err)
 	}
-	existingBackgrounds := NewExistingBackgrounds(brRequest.DownloadPath, br.conf.ExistingImagesFilename, br.logger)
-	err = br.getBackgroundsWithBatching(brRequest, existingBackgrounds)
 	if err != nil {
-		return "Error", err
+		return *run.summary, err
+	}
+	if brRequest.DryRun {
+		br.logger.Info("Finished dry run", zap.Int("candidates", len(run.summary.Candidates)), zap.Any("rejections", run.summary.Rejections))
+		return *run.summary, nil
 	}
-	err = br.userSettingsMan.SaveNewUserSettings(brRequest.DownloadPath)
+	err = br.saveRequestToUserSettings(run.request)
 	if err != nil {
 		br.logger.Error("Failed to save user settings", zap.Error(err))
-		return "Error", fmt.Errorf("failed to save user settings")
+		return *run.summary, fmt.Errorf("failed to save user settings")
+	}
+	br.logger.Info("Finished retrieving backgrounds", zap.Any("summary", run.summary))
+	return *run.summary, nil
+}
+
+// lockDownloadPath stops two runs downloading into the same directory, where they would download the same posts and
+// overwrite each other's index
+func (br *BackgroundRetriever) lockDownloadPath(downloadPath string, wait bool) (*dir_lock.Lock, error) {
+	if !wait {
+		return dir_lock.Acquire(downloadPath, br.conf.DownloadLockFilename)
+	}
+	lock, err := dir_lock.Acquire(downloadPath, br.conf.DownloadLockFilename)
+	var lockedErr *dir_lock.LockedError
+	if errors.As(err, &lockedErr) {
+		br.logger.Info(fmt.Sprintf("Waiting for another earthpullr to finish using '%s'", downloadPath), zap.Int("pid", lockedErr.Owner.PID))
+		return dir_lock.AcquireWait(br.ctx, downloadPath, br.conf.DownloadLockFilename)
+	}
+	return lock, err
+}
+
+func (br *BackgroundRetriever) unlockDownloadPath(lock *dir_lock.Lock) {
+	err := lock.Release()
+	if err != nil {
+		br.logger.Warn("Failed to release the download directory lock", zap.Error(err))
+	}
+}
+
+// newRun validates the request's output format and filters, filling in their defaults
+func (br *BackgroundRetriever) newRun(brRequest BackgroundsRequest, existingBackgrounds *ExistingBackgrounds) (*backgroundsRun, error) {
+	err := user_settings.ValidateOutputFormat(brRequest.OutputFormat, brRequest.JPEGQuality)
+	if err != nil {
+		return nil, err
+	}
+	if brRequest.Filters.AspectRatioTolerance == 0 {
+		brRequest.Filters.AspectRatioTolerance = ACCEPTABLE_ASPECT_DIFF
+	}
+	// The config defaults are not saved to the user settings so later changes to the config still apply
+	titleFilters := brRequest.Filters
+	br.addDefaultTitleFilters(&titleFilters)
+	titleFilter, err := newTitleFilter(titleFilters)
+	if err != nil {
+		return nil, err
+	}
+	locationFilter, err := newLocationFilter(brRequest.Filters)
+	if err != nil {
+		return nil, err
+	}
+	colourFilter, err := newColourFilter(brRequest.Filters)
+	if err != nil {
+		return nil, err
+	}
+	return newBackgroundsRun(brRequest, existingBackgrounds, http_retry.NewPolicy(br.conf.HttpMaxAttempts), br.getBandwidthLimiter(brRequest), br.curation, titleFilter, locationFilter, colourFilter, br.conf.WriteSidecars, br.hooks), nil
+}
+
+func (br *BackgroundRetriever) parseSources(rawSources []string) ([]listing_sources.Source, error) {
+	var sources []listing_sources.Source
+	for _, rawSource := range rawSources {
+		source, err := listing_sources.Parse(rawSource)
+		if err != nil {
+			return nil, err
+		}
+		if source.RequiresUser() {
+			if _, err := br.tokenStore.Load(); err != nil {
+				return nil, fmt.Errorf("log in to reddit with the history scope to use '%s' as a source: %w", rawSource, err)
+			}
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// addDefaultTitleFilters uses the title filters from the config for any the request leaves unset
+func (br *BackgroundRetriever) addDefaultTitleFilters(filters *user_settings.Filters) {
+	if len(filters.TitleIncludeKeywords) == 0 {
+		filters.TitleIncludeKeywords = br.conf.TitleIncludeKeywords
+	}
+	if len(filters.TitleExcludeKeywords) == 0 {
+		filters.TitleExcludeKeywords = br.conf.TitleExcludeKeywords
+	}
+	if len(filters.TitleIncludePatterns) == 0 {
+		filters.TitleIncludePatterns = br.conf.TitleIncludePatterns
+	}
+	if len(filters.TitleExcludePatterns) == 0 {
+		filters.TitleExcludePatterns = br.conf.TitleExcludePatterns
 	}
-	return "Success", nil
+}
+
+func (br *BackgroundRetriever) getBandwidthLimiter(brRequest BackgroundsRequest) *bandwidth.Limiter {
+	if brRequest.Metered && br.meteredBandwidthLimiter != nil {
+		return br.meteredBandwidthLimiter
+	}
+	return br.bandwidthLimiter
 }
 
 //func (br *BackgroundRetriever) SetNextBackground() (string, error) {
 //
 //}
 
-func (br *BackgroundRetriever) getBackgroundsWithBatching(brRequest BackgroundsRequest, existingBackgrounds *ExistingBackgrounds) error {
-	savedImages := 0
-	afterUID := ""
-	for savedImages < brRequest.BackgroundsCount {
-		listingRequest, err := NewListingRequest(
-			br.ctx,
-			br.client,
-			br.conf,
-			"",
-			afterUID,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to get Listings for subreddit: %v", err)
-		}
-		listingResponse, err := listingRequest.DoRequest()
-		if err != nil {
-			return fmt.Errorf("failed to get Listings for subreddit: %v", err)
+func (br *BackgroundRetriever) saveRequestToUserSettings(brRequest BackgroundsRequest) error {
+	settings := br.settings()
+	settings.DownloadPath = brRequest.DownloadPath
+	settings.Width = brRequest.Width
+	settings.Height = brRequest.Height
+	settings.BackgroundsCount = brRequest.BackgroundsCount
+	settings.Sources = brRequest.Sources
+	settings.Filters = brRequest.Filters
+	settings.OutputFormat = brRequest.OutputFormat
+	settings.JPEGQuality = brRequest.JPEGQuality
+	return br.updateSettings(settings)
+}
+
+func (br *BackgroundRetriever) getBackgroundsWithBatching(ctx context.Context, run *backgroundsRun, sources []listing_sources.Source) error {
+	brRequest := run.request
+	for _, source := range sources {
+		afterUID := ""
+		for run.found() < brRequest.BackgroundsCount {
+			listingRequest, err := NewListingRequest(
+				ctx,
+				br.client,
+				br.conf,
+				source,
+				"",
+				afterUID,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to get Listings for '%s': %w", source, err)
+			}
+			listingResponse, err := listingRequest.DoRequest()
+			if err != nil {
+				return fmt.Errorf("failed to get Listings for '%s': %w", source, err)
+			}
+			remainingImagesCount := brRequest.BackgroundsCount - run.found()
+			imagesRetriever, err := NewImagesRetriever(br.logger, ctx, listingResponse, source.String(), br.client, remainingImagesCount, run)
+			if err != nil {
+				err = fmt.Errorf("failed to retrieve image batch: %v", err)
+				return err
+			}
+			err = imagesRetriever.SaveImages(br.runtime)
+			if err != nil {
+				br.logger.Error("Failed to save image batch", zap.Error(err))
+				run.batchErr = err
+			}
+			afterUID = imagesRetriever.finalImageUID
+			if afterUID == "" {
+				// Reached the end of this source's listing
+				break
+			}
 		}
-		remainingImagesCount := brRequest.BackgroundsCount - savedImages
-		imagesRetriever, err := NewImagesRetriever(br.logger, br.ctx, listingResponse, br.client, remainingImagesCount, brRequest.Width, brRequest.Height, existingBackgrounds)
-		afterUID = imagesRetriever.finalImageUID
+	}
+	if !brRequest.DryRun {
+		err := run.existingBackgrounds.SaveExistingBackgrounds()
 		if err != nil {
-			err = fmt.Errorf("failed to retrieve image batch: %v", err)
 			return err
 		}
-		imagesRetriever.SaveImages(brRequest.DownloadPath, br.runtime, existingBackgrounds)
-		savedImages += imagesRetriever.imageCount
 	}
-	return existingBackgrounds.SaveExistingBackgrounds()
+	// A failed batch is retried with the next one, it only fails the run if too few backgrounds were found
+	if run.batchErr != nil && run.found() < brRequest.BackgroundsCount {
+		return fmt.Errorf("found %d of %d backgrounds, failed to save image batch: %w", run.found(), brRequest.BackgroundsCount, run.batchErr)
+	}
+	return nil
 }
 
-func (br *BackgroundRetriever) addOAuthTokenToCtx() error {
-	redditOauth, err := reddit_oauth.NewApplicationOnlyOAuthRequest(br.ctx, br.client, br.conf)
+// Login authorizes earthpullr to act as a reddit user, returning their username if the identity scope was granted
+func (br *BackgroundRetriever) Login(scopes []string) (string, error) {
+	flow := reddit_oauth.NewAuthorizationCodeFlow(br.client, br.conf, br.tokenStore, scopes, browser.OpenURL)
+	_, login, err := flow.Login(br.ctx)
 	if err != nil {
-		return fmt.Errorf("failed to build request to retrieve oauth Token from reddit: %v", err)
+		return "", fmt.Errorf("failed to log in to reddit: %v", err)
 	}
-	oauthToken, err := redditOauth.NewOAuthToken()
+	br.logger.Info("Logged in to reddit", zap.String("username", login.Username), zap.String("scope", login.Scope))
+	return login.Username, nil
+}
+
+func (br *BackgroundRetriever) Logout() error {
+	err := br.tokenStore.Delete()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve oauth Token from reddit: %v", err)
+		return fmt.Errorf("failed to remove reddit login: %v", err)
 	}
-	br.ctx = reddit_oauth.ToContext(br.ctx, oauthToken)
+	br.logger.Info("Logged out of reddit")
 	return nil
 }
+
+// GetLoggedInUser returns an empty string when using application only access
+func (br *BackgroundRetriever) GetLoggedInUser() string {
+	login, err := br.tokenStore.Load()
+	if err != nil {
+		return ""
+	}
+	return login.Username
+}
+
+// getOAuthTokenRetriever prefers a logged in user's token over application only access
+func (br *BackgroundRetriever) getOAuthTokenRetriever() (reddit_oauth.OAuthTokenRetriever, error) {
+	_, err := br.tokenStore.Load()
+	if err == nil {
+		return reddit_oauth.NewRefreshTokenRequest(br.ctx, br.client, br.conf, br.tokenStore), nil
+	} else if !errors.Is(err, reddit_oauth.ErrNotLoggedIn) {
+		br.logger.Error("Failed to load reddit login, falling back to application only access", zap.Error(err))
+	}
+	return reddit_oauth.NewApplicationOnlyOAuthRequest(br.ctx, br.client, br.conf)
+}
+
+// oauthContext retrieves a new token for a run, returning a context carrying it for the run's requests
+func (br *BackgroundRetriever) oauthContext() (context.Context, error) {
+	redditOauth, err := br.getOAuthTokenRetriever()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request to retrieve oauth Token from reddit: %w", err)
+	}
+	oauthToken, err := redditOauth.NewOAuthToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve oauth Token from reddit: %w", err)
+	}
+	return reddit_oauth.ToContext(br.ctx, oauthToken), nil
+}
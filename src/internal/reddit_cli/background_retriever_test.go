@@ -0,0 +1,328 @@
+package reddit_cli
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/pkg/http_client"
+	"earthpullr/pkg/image_format"
+	"earthpullr/pkg/mock_reddit"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const (
+	fixtureCount  = 7
+	fixtureWidth  = 480
+	fixtureHeight = 270
+)
+
+func TestMain(m *testing.M) {
+	if hookLog := os.Getenv(failingHookLogEnv); hookLog != "" {
+		failingHook(hookLog)
+	}
+	// The user settings, curation and login are stored in the user config directory
+	configDir, err := ioutil.TempDir("", "earthpullr-test-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", configDir)
+	os.Setenv("HOME", configDir)
+	os.Setenv("AppData", configDir)
+	code := m.Run()
+	os.RemoveAll(configDir)
+	os.Exit(code)
+}
+
+// writeFixtures writes 16:9 images at and above the fixture resolution, alternating between JPEG and PNG
+func writeFixtures(t *testing.T, dir string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		width, height := fixtureWidth+16*i, fixtureHeight+9*i
+		img := stdimage.NewRGBA(stdimage.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(i * 30), 255})
+			}
+		}
+		name := fmt.Sprintf("Lake_%d,_New_Zealand_[OC]_[%dx%d]", i, width, height)
+		var err error
+		if i%2 == 0 {
+			err = writeImage(filepath.Join(dir, name+".jpg"), func(f *os.File) error { return jpeg.Encode(f, img, nil) })
+		} else {
+			err = writeImage(filepath.Join(dir, name+".png"), func(f *os.File) error { return png.Encode(f, img) })
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeImage(fpath string, encode func(f *os.File) error) error {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return encode(f)
+}
+
+// useConfigDir gives the test its own user config directory so curation such as bans doesn't leak into other tests
+func useConfigDir(t *testing.T) {
+	t.Helper()
+	configDir := t.TempDir()
+	for _, key := range []string{"XDG_CONFIG_HOME", "HOME", "AppData"} {
+		previous, ok := os.LookupEnv(key)
+		os.Setenv(key, configDir)
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
+
+// newTestRetriever serves fixtures from a mock reddit with the given faults, returning a retriever using it and an
+// empty download directory
+func newTestRetriever(t *testing.T, faults mock_reddit.Faults, configure func(conf *config.Config)) (*BackgroundRetriever, *mock_reddit.Server, string) {
+	t.Helper()
+	useConfigDir(t)
+	fixtureDir := t.TempDir()
+	writeFixtures(t, fixtureDir, fixtureCount)
+	server := mock_reddit.NewServer(fixtureDir, faults)
+	err := server.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	conf := config.NewDefaultConfig()
+	conf.RedditAccessTokenUrl = server.AccessTokenURL()
+	conf.RedditApiEndpoint = server.URL()
+	conf.QueryBatchSize = 3
+	conf.HttpTimeoutSecs = 5
+	if configure != nil {
+		configure(&conf)
+	}
+	retriever, err := NewBackgroundRetriever(context.Background(), zap.NewNop(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return retriever, server, t.TempDir()
+}
+
+func testRequest(downloadPath string, count int) BackgroundsRequest {
+	return BackgroundsRequest{
+		Width:            fixtureWidth,
+		Height:           fixtureHeight,
+		BackgroundsCount: count,
+		DownloadPath:     downloadPath,
+	}
+}
+
+// savedImages lists the images in the download directory, ignoring the index and lock
+func savedImages(t *testing.T, downloadPath string) []string {
+	t.Helper()
+	files, err := ioutil.ReadDir(downloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images []string
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if ext == ".jpg" || ext == ".png" {
+			images = append(images, file.Name())
+		}
+	}
+	return images
+}
+
+func TestFetchBackgroundsPaginates(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+
+	// Five backgrounds take two pages of three posts
+	summary, err := retriever.FetchBackgrounds(testRequest(downloadPath, 5), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SavedImages != 5 {
+		t.Fatalf("saved %d backgrounds, want 5", summary.SavedImages)
+	}
+	if images := savedImages(t, downloadPath); len(images) != 5 {
+		t.Fatalf("found %d images in the download directory, want 5: %v", len(images), images)
+	}
+	index := NewExistingBackgrounds(downloadPath, retriever.conf.ExistingImagesFilename, zap.NewNop())
+	if len(index.Backgrounds()) != 5 {
+		t.Fatalf("indexed %d backgrounds, want 5", len(index.Backgrounds()))
+	}
+
+	// Asking for more than are left stops at the end of the listing, skipping those already downloaded
+	summary, err = retriever.FetchBackgrounds(testRequest(downloadPath, 5), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SavedImages != fixtureCount-5 {
+		t.Fatalf("saved %d backgrounds, want %d", summary.SavedImages, fixtureCount-5)
+	}
+	if summary.Rejections[rejectedAlreadyDownloaded] != 5 {
+		t.Fatalf("got rejections %v, want 5 already downloaded", summary.Rejections)
+	}
+}
+
+func TestFetchBackgroundsRetriesRateLimitsAndServerErrors(t *testing.T) {
+	faults := mock_reddit.Faults{RateLimitEvery: 3, ServerErrorEvery: 7}
+	retriever, _, downloadPath := newTestRetriever(t, faults, func(conf *config.Config) {
+		conf.HttpMaxAttempts = 3
+	})
+
+	summary, err := retriever.FetchBackgrounds(testRequest(downloadPath, 5), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SavedImages != 5 {
+		t.Fatalf("saved %d backgrounds, want 5", summary.SavedImages)
+	}
+}
+
+func TestFetchBackgroundsReportsRateLimitAfterRetries(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{RateLimitEvery: 1}, func(conf *config.Config) {
+		conf.HttpMaxAttempts = 2
+	})
+
+	_, err := retriever.FetchBackgrounds(testRequest(downloadPath, 5), nil)
+	if !errors.Is(err, http_client.ErrRateLimited) {
+		t.Fatalf("expected a rate limited error, got %v", err)
+	}
+}
+
+func TestFetchBackgroundsMalformedListing(t *testing.T) {
+	// The token request succeeds and the first listing is cut off
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{MalformedJSONEvery: 2}, nil)
+
+	summary, err := retriever.FetchBackgrounds(testRequest(downloadPath, 5), nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to get Listings") {
+		t.Fatalf("expected the malformed listing to fail the run, got %v", err)
+	}
+	if summary.SavedImages != 0 {
+		t.Fatalf("saved %d backgrounds from a malformed listing", summary.SavedImages)
+	}
+}
+
+func TestFetchBackgroundsRejectsRemovedImagePlaceholders(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{RemovedImageEvery: 2}, nil)
+
+	summary, err := retriever.FetchBackgrounds(testRequest(downloadPath, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SavedImages != 3 {
+		t.Fatalf("saved %d backgrounds, want 3", summary.SavedImages)
+	}
+	if summary.Rejections[rejectedPlaceholder] != 2 {
+		t.Fatalf("got rejections %v, want 2 placeholders", summary.Rejections)
+	}
+	for _, fname := range savedImages(t, downloadPath) {
+		img, _, err := image_format.DecodeFile(filepath.Join(downloadPath, fname))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() < fixtureWidth {
+			t.Fatalf("saved the placeholder as '%s'", fname)
+		}
+	}
+}
+
+func TestFetchBackgroundsDryRun(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	request := testRequest(downloadPath, 4)
+	request.DryRun = true
+
+	summary, err := retriever.FetchBackgrounds(request, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Candidates) != 4 || summary.SavedImages != 0 {
+		t.Fatalf("got %d candidates and %d saved, want 4 candidates and none saved", len(summary.Candidates), summary.SavedImages)
+	}
+	for _, candidate := range summary.Candidates {
+		if candidate.Width < fixtureWidth || candidate.Height < fixtureHeight || candidate.PostID == "" {
+			t.Fatalf("invalid candidate %+v", candidate)
+		}
+	}
+	files, err := ioutil.ReadDir(downloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("dry run wrote %d files to the download directory", len(files))
+	}
+}
+
+func TestFetchBackgroundsFailsWhenEveryBatchFails(t *testing.T) {
+	retriever, server, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	posts, err := server.Posts(retriever.conf.Subreddit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A directory in the way of each partial download makes saving every image fail
+	for _, post := range posts {
+		err = os.Mkdir(filepath.Join(downloadPath, post.Name+downloadSuffix), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := retriever.FetchBackgrounds(testRequest(downloadPath, 3), nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to save image batch") {
+		t.Fatalf("expected failed batches to fail the run, got %v", err)
+	}
+	if summary.SavedImages != 0 {
+		t.Fatalf("saved %d backgrounds", summary.SavedImages)
+	}
+}
+
+func TestRetrieverIsBusyDuringFetch(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	progress := func(ProgressEvent) {
+		select {
+		case <-started:
+		default:
+			close(started)
+			<-release
+		}
+	}
+	err := retriever.StartFetch(testRequest(downloadPath, 2), progress, func(_ RunSummary, err error) { done <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := retriever.FetchBackgrounds(testRequest(downloadPath, 1), nil); !errors.Is(err, ErrBusy) {
+		t.Errorf("expected a fetch to be refused while another runs, got %v", err)
+	}
+	if _, err := retriever.UpdateSettings(map[string]interface{}{"Width": 100}); !errors.Is(err, ErrBusy) {
+		t.Errorf("expected a settings update to be refused while a fetch runs, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retriever.FetchBackgrounds(testRequest(downloadPath, 1), nil); err != nil {
+		t.Fatalf("expected a fetch once the first finished, got %v", err)
+	}
+}
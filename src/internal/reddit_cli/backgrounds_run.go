@@ -0,0 +1,106 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/curation"
+	"earthpullr/pkg/bandwidth"
+	"earthpullr/pkg/http_retry"
+	"time"
+)
+
+// RunSummary is returned to the caller once a request for backgrounds completes
+type RunSummary struct {
+	SavedImages   int            `json:"saved_images"`
+	Rejections    map[string]int `json:"rejections"`
+	ThrottledSecs float64        `json:"throttled_secs"`
+	// Candidates are the backgrounds a dry run would have saved
+	Candidates []Candidate `json:"candidates,omitempty"`
+}
+
+// Candidate is a background found by a dry run, its resolution is that of the downloaded image
+type Candidate struct {
+	PostID    string `json:"post_id"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Permalink string `json:"permalink,omitempty"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Source    string `json:"source"`
+}
+
+// ProgressEvent is reported after each background a run saves
+type ProgressEvent struct {
+	Path             string `json:"path"`
+	PostID           string `json:"post_id"`
+	Title            string `json:"title"`
+	SavedImages      int    `json:"saved_images"`
+	BackgroundsCount int    `json:"backgrounds_count"`
+}
+
+// backgroundsRun holds the state shared by every batch of a single request for backgrounds
+type backgroundsRun struct {
+	request             BackgroundsRequest
+	existingBackgrounds *ExistingBackgrounds
+	retryPolicy         http_retry.Policy
+	limiter             *bandwidth.Limiter
+	curation            *curation.Manager
+	titleFilter         *titleFilter
+	locationFilter      *locationFilter
+	colourFilter        *colourFilter
+	writeSidecars       bool
+	hooks               *downloadHooks
+	summary             *RunSummary
+	// savedPaths are passed to the run finished hook
+	savedPaths []string
+	// batchErr is the last error saving a batch, it only fails the run when too few backgrounds were found
+	batchErr error
+	// progress is nil when nothing is following the run
+	progress func(ProgressEvent)
+}
+
+func newBackgroundsRun(request BackgroundsRequest, existingBackgrounds *ExistingBackgrounds, retryPolicy http_retry.Policy, limiter *bandwidth.Limiter, curation *curation.Manager, titleFilter *titleFilter, locationFilter *locationFilter, colourFilter *colourFilter, writeSidecars bool, hooks *downloadHooks) *backgroundsRun {
+	return &backgroundsRun{
+		request:             request,
+		existingBackgrounds: existingBackgrounds,
+		retryPolicy:         retryPolicy,
+		limiter:             limiter,
+		curation:            curation,
+		titleFilter:         titleFilter,
+		locationFilter:      locationFilter,
+		colourFilter:        colourFilter,
+		writeSidecars:       writeSidecars,
+		hooks:               hooks,
+		summary: &RunSummary{
+			Rejections: map[string]int{},
+		},
+	}
+}
+
+func (run *backgroundsRun) addRejection(reason string) {
+	run.summary.Rejections[reason] += 1
+}
+
+// found is the number of backgrounds saved, or found by a dry run
+func (run *backgroundsRun) found() int {
+	if run.request.DryRun {
+		return len(run.summary.Candidates)
+	}
+	return run.summary.SavedImages
+}
+
+func (run *backgroundsRun) imageSaved(filePath string, metadata BackgroundMetadata) {
+	run.summary.SavedImages += 1
+	run.savedPaths = append(run.savedPaths, filePath)
+	if run.progress != nil {
+		run.progress(ProgressEvent{
+			Path:             filePath,
+			PostID:           metadata.PostID,
+			Title:            metadata.Title,
+			SavedImages:      run.summary.SavedImages,
+			BackgroundsCount: run.request.BackgroundsCount,
+		})
+	}
+}
+
+func (run *backgroundsRun) addThrottled(throttled time.Duration) {
+	run.summary.ThrottledSecs += throttled.Seconds()
+}
@@ -0,0 +1,83 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/user_settings"
+	"earthpullr/pkg/image_colour"
+	"earthpullr/pkg/system_theme"
+	"fmt"
+	"go.uber.org/zap"
+)
+
+// Luminance limits of the dark and light brightness presets
+const (
+	darkMaxLuminance  = 0.35
+	lightMinLuminance = 0.55
+)
+
+// colourFilter rejects backgrounds by their colour analysis, which is only available once an image is downloaded
+type colourFilter struct {
+	minLuminance float64
+	maxLuminance float64
+	hues         []string
+}
+
+func newColourFilter(filters user_settings.Filters) (*colourFilter, error) {
+	err := filters.ValidateColourFilters()
+	if err != nil {
+		return nil, err
+	}
+	filter := &colourFilter{
+		minLuminance: filters.MinLuminance,
+		maxLuminance: filters.MaxLuminance,
+		hues:         filters.DominantHues,
+	}
+	if filter.maxLuminance == 0 {
+		filter.maxLuminance = 1
+	}
+	brightness := filters.Brightness
+	if brightness == user_settings.BrightnessSystem {
+		dark, err := system_theme.IsDark()
+		if err != nil {
+			return nil, fmt.Errorf("failed to follow the system theme: %v", err)
+		}
+		brightness = user_settings.BrightnessLight
+		if dark {
+			brightness = user_settings.BrightnessDark
+		}
+	}
+	switch brightness {
+	case user_settings.BrightnessDark:
+		if filter.maxLuminance > darkMaxLuminance {
+			filter.maxLuminance = darkMaxLuminance
+		}
+	case user_settings.BrightnessLight:
+		if filter.minLuminance < lightMinLuminance {
+			filter.minLuminance = lightMinLuminance
+		}
+	}
+	return filter, nil
+}
+
+// rejectionReason returns rejectedBrightness or rejectedColour, or an empty string if the background is allowed
+func (filter *colourFilter) rejectionReason(logger *zap.Logger, uid string, analysis image_colour.Analysis) string {
+	if analysis.MeanLuminance < filter.minLuminance || analysis.MeanLuminance > filter.maxLuminance {
+		logger.Debug(fmt.Sprintf(
+			"Image '%s' has luminance %.3f, required between %.3f and %.3f",
+			uid,
+			analysis.MeanLuminance,
+			filter.minLuminance,
+			filter.maxLuminance,
+		))
+		return rejectedBrightness
+	}
+	if len(filter.hues) == 0 {
+		return ""
+	}
+	for _, hue := range filter.hues {
+		if analysis.DominantHue == hue {
+			return ""
+		}
+	}
+	logger.Debug(fmt.Sprintf("Image '%s' is %s dominant, required one of %v", uid, analysis.DominantHue, filter.hues))
+	return rejectedColour
+}
@@ -0,0 +1,77 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/user_settings"
+	"earthpullr/pkg/image_colour"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func solidAnalysis(c color.RGBA) image_colour.Analysis {
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, 160, 90))
+	draw.Draw(img, img.Bounds(), &stdimage.Uniform{C: c}, stdimage.Point{}, draw.Src)
+	return image_colour.Analyse(img)
+}
+
+func TestColourFilter(t *testing.T) {
+	var (
+		black    = color.RGBA{0, 0, 0, 255}
+		white    = color.RGBA{255, 255, 255, 255}
+		midGrey  = color.RGBA{119, 119, 119, 255}
+		darkBlue = color.RGBA{0, 0, 140, 255}
+		// Just either side of a hue of 0
+		crimson = color.RGBA{255, 0, 9, 255}
+		scarlet = color.RGBA{255, 9, 0, 255}
+	)
+	tests := []struct {
+		name    string
+		filters user_settings.Filters
+		colour  color.RGBA
+		want    string
+	}{
+		{name: "no filters", colour: midGrey},
+		{name: "dark allows black", filters: user_settings.Filters{Brightness: user_settings.BrightnessDark}, colour: black},
+		{name: "dark rejects white", filters: user_settings.Filters{Brightness: user_settings.BrightnessDark}, colour: white, want: rejectedBrightness},
+		{name: "light allows white", filters: user_settings.Filters{Brightness: user_settings.BrightnessLight}, colour: white},
+		{name: "light rejects mid grey", filters: user_settings.Filters{Brightness: user_settings.BrightnessLight}, colour: midGrey, want: rejectedBrightness},
+		{name: "within luminance range", filters: user_settings.Filters{MinLuminance: 0.4, MaxLuminance: 0.6}, colour: midGrey},
+		{name: "below luminance range", filters: user_settings.Filters{MinLuminance: 0.4, MaxLuminance: 0.6}, colour: black, want: rejectedBrightness},
+		{name: "above minimum luminance without a maximum", filters: user_settings.Filters{MinLuminance: 0.4}, colour: white},
+		{name: "dark narrows the maximum luminance", filters: user_settings.Filters{Brightness: user_settings.BrightnessDark, MaxLuminance: 0.6}, colour: midGrey, want: rejectedBrightness},
+		{name: "matching hue", filters: user_settings.Filters{DominantHues: []string{image_colour.HueBlue}}, colour: darkBlue},
+		{name: "other hue", filters: user_settings.Filters{DominantHues: []string{image_colour.HueGreen}}, colour: darkBlue, want: rejectedColour},
+		{name: "neutral hue", filters: user_settings.Filters{DominantHues: []string{image_colour.HueNeutral}}, colour: midGrey},
+		{name: "red below 360", filters: user_settings.Filters{DominantHues: []string{image_colour.HueRed}}, colour: crimson},
+		{name: "red above 0", filters: user_settings.Filters{DominantHues: []string{image_colour.HueRed}}, colour: scarlet},
+		{name: "red rejected as pink", filters: user_settings.Filters{DominantHues: []string{image_colour.HuePink}}, colour: crimson, want: rejectedColour},
+		{name: "dark and blue", filters: user_settings.Filters{Brightness: user_settings.BrightnessDark, DominantHues: []string{image_colour.HueBlue}}, colour: darkBlue},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := newColourFilter(test.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.rejectionReason(zap.NewNop(), "t3_a", solidAnalysis(test.colour)); got != test.want {
+				t.Fatalf("got rejection '%s', want '%s'", got, test.want)
+			}
+		})
+	}
+}
+
+func TestColourFilterInvalid(t *testing.T) {
+	for _, filters := range []user_settings.Filters{
+		{MinLuminance: 0.8, MaxLuminance: 0.2},
+		{MinLuminance: -0.1},
+		{DominantHues: []string{"turquoise"}},
+		{Brightness: "dusk"},
+	} {
+		if _, err := newColourFilter(filters); err == nil {
+			t.Fatalf("expected %+v to be invalid", filters)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package reddit_cli
+
+import (
+	"errors"
+	"syscall"
+)
+
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT)
+}
@@ -0,0 +1,16 @@
+package reddit_cli
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes, the syscall package doesn't name them
+const (
+	errorHandleDiskFull syscall.Errno = 39
+	errorDiskFull       syscall.Errno = 112
+)
+
+func isDiskFull(err error) bool {
+	return errors.Is(err, errorDiskFull) || errors.Is(err, errorHandleDiskFull)
+}
@@ -0,0 +1,91 @@
+package reddit_cli
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/pkg/command_hook"
+	"go.uber.org/zap"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hook names, also passed to the commands as EARTHPULLR_EVENT
+const (
+	hookImageSaved  = "image_saved"
+	hookRunFinished = "run_finished"
+)
+
+// downloadHooks runs the commands configured to run after each saved image and each finished run, failures are logged
+// by the runner and never abort the run
+type downloadHooks struct {
+	runner      *command_hook.Runner
+	imageSaved  []string
+	runFinished []string
+}
+
+func newDownloadHooks(logger *zap.Logger, conf config.Config) *downloadHooks {
+	return &downloadHooks{
+		runner:      command_hook.NewRunner(logger, time.Duration(conf.HookTimeoutSecs)*time.Second),
+		imageSaved:  conf.ImageSavedHook,
+		runFinished: conf.RunFinishedHook,
+	}
+}
+
+type imageSavedPayload struct {
+	Event        string             `json:"event"`
+	Path         string             `json:"path"`
+	DownloadPath string             `json:"download_path"`
+	Metadata     BackgroundMetadata `json:"metadata"`
+}
+
+type runFinishedPayload struct {
+	Event        string     `json:"event"`
+	DownloadPath string     `json:"download_path"`
+	SavedPaths   []string   `json:"saved_paths"`
+	Summary      RunSummary `json:"summary"`
+	Error        string     `json:"error,omitempty"`
+}
+
+func (hooks *downloadHooks) imageSavedHook(ctx context.Context, downloadPath string, filePath string, metadata BackgroundMetadata) {
+	env := map[string]string{
+		"EARTHPULLR_EVENT":         hookImageSaved,
+		"EARTHPULLR_IMAGE_PATH":    filePath,
+		"EARTHPULLR_DOWNLOAD_PATH": downloadPath,
+		"EARTHPULLR_POST_ID":       metadata.PostID,
+		"EARTHPULLR_TITLE":         metadata.Title,
+		"EARTHPULLR_AUTHOR":        metadata.Author,
+		"EARTHPULLR_SUBREDDIT":     metadata.Subreddit,
+		"EARTHPULLR_PERMALINK":     metadata.Permalink,
+		"EARTHPULLR_WIDTH":         strconv.Itoa(metadata.Width),
+		"EARTHPULLR_HEIGHT":        strconv.Itoa(metadata.Height),
+	}
+	payload := imageSavedPayload{Event: hookImageSaved, Path: filePath, DownloadPath: downloadPath, Metadata: metadata}
+	_ = hooks.runner.Run(ctx, hookImageSaved, hooks.imageSaved, env, payload)
+}
+
+// runFinishedHook is run whether or not the run succeeded, runErr is passed to the command as EARTHPULLR_ERROR
+func (hooks *downloadHooks) runFinishedHook(ctx context.Context, run *backgroundsRun, runErr error) {
+	payload := runFinishedPayload{
+		Event:        hookRunFinished,
+		DownloadPath: run.request.DownloadPath,
+		SavedPaths:   run.savedPaths,
+		Summary:      *run.summary,
+	}
+	if payload.SavedPaths == nil {
+		payload.SavedPaths = []string{}
+	}
+	if runErr != nil {
+		payload.Error = runErr.Error()
+	}
+	env := map[string]string{
+		"EARTHPULLR_EVENT":         hookRunFinished,
+		"EARTHPULLR_DOWNLOAD_PATH": run.request.DownloadPath,
+		"EARTHPULLR_SAVED_IMAGES":  strconv.Itoa(run.summary.SavedImages),
+		// Paths are separated like PATH, by a colon or a semicolon on Windows
+		"EARTHPULLR_SAVED_PATHS": strings.Join(run.savedPaths, string(os.PathListSeparator)),
+		"EARTHPULLR_ERROR":       payload.Error,
+	}
+	_ = hooks.runner.Run(ctx, hookRunFinished, hooks.runFinished, env, payload)
+}
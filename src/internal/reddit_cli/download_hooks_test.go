@@ -0,0 +1,47 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/config"
+	"earthpullr/pkg/mock_reddit"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingHookLogEnv makes the test binary act as a hook command which records the image it was run for then fails
+const failingHookLogEnv = "EARTHPULLR_TEST_FAILING_HOOK_LOG"
+
+func failingHook(hookLog string) {
+	f, err := os.OpenFile(hookLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil {
+		f.WriteString(os.Getenv("EARTHPULLR_IMAGE_PATH") + "\n")
+		f.Close()
+	}
+	os.Exit(1)
+}
+
+func TestFailingImageSavedHookDoesNotFailRun(t *testing.T) {
+	hookLog := filepath.Join(t.TempDir(), "hook.log")
+	os.Setenv(failingHookLogEnv, hookLog)
+	t.Cleanup(func() { os.Unsetenv(failingHookLogEnv) })
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, func(conf *config.Config) {
+		conf.ImageSavedHook = []string{os.Args[0]}
+	})
+
+	summary, err := retriever.FetchBackgrounds(testRequest(downloadPath, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SavedImages != 3 || len(savedImages(t, downloadPath)) != 3 {
+		t.Fatalf("saved %d images, want 3", summary.SavedImages)
+	}
+	out, err := ioutil.ReadFile(hookLog)
+	if err != nil {
+		t.Fatalf("expected the hook to be run: %v", err)
+	}
+	if runs := strings.Split(strings.TrimSpace(string(out)), "\n"); len(runs) != 3 {
+		t.Fatalf("hook was run for %v, want each of the 3 images", runs)
+	}
+}
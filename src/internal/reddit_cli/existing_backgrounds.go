@@ -1,18 +1,43 @@
 package reddit_cli
 
 import (
-	"earthpullr/pkg/file_readers"
+	"earthpullr/internal/gazetteer"
+	"earthpullr/internal/title_parser"
+	"earthpullr/pkg/image_colour"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+// BackgroundMetadata is stored for each downloaded background, backgrounds downloaded by older versions were only
+// recorded by file name so have no metadata
+type BackgroundMetadata struct {
+	PostID    string    `json:"post_id,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Subreddit string    `json:"subreddit,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Permalink string    `json:"permalink,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	SavedAt   time.Time `json:"saved_at"`
+	title_parser.TitleMetadata
+	// Location is nil when the title doesn't mention a known place
+	Location *gazetteer.Location `json:"location,omitempty"`
+	// Colour is nil for backgrounds which have not been analysed
+	Colour *image_colour.Analysis `json:"colour,omitempty"`
+}
+
 type ExistingBackgrounds struct {
 	logger *zap.Logger
 	fpath string
-	existingBackgrounds *map[string]string
+	existingBackgrounds map[string]BackgroundMetadata
 }
 
 func NewExistingBackgrounds(downloadPath string, existingImagesFname string, logger *zap.Logger) *ExistingBackgrounds {
@@ -24,37 +49,115 @@ func NewExistingBackgrounds(downloadPath string, existingImagesFname string, log
 	return &ebs
 }
 
-func (eb *ExistingBackgrounds) getExistingBackgroundsMap() *map[string]string {
-	existingBackgrounds := map[string]string{}
+func (eb *ExistingBackgrounds) getExistingBackgroundsMap() map[string]BackgroundMetadata {
+	existingBackgrounds := map[string]BackgroundMetadata{}
 	if _, err := os.Stat(eb.fpath); errors.Is(err, os.ErrNotExist) {
 		// Existing backgrounds file doesn't exist
-		return &existingBackgrounds
+		return existingBackgrounds
 	}
-	existingBackgroundsJson, err := file_readers.NewFlatJsonFile(eb.fpath)
+	byteValue, err := ioutil.ReadFile(eb.fpath)
 	if err != nil {
 		eb.logger.Error("failed to read existing images json file", zap.Error(err))
-		return &existingBackgrounds
+		return existingBackgrounds
+	}
+	var rawBackgrounds map[string]json.RawMessage
+	err = json.Unmarshal(byteValue, &rawBackgrounds)
+	if err != nil {
+		eb.logger.Error("failed to unmarshall existing images json file", zap.Error(err))
+		return existingBackgrounds
 	}
-	return &existingBackgroundsJson.Data
+	for fname, rawMetadata := range rawBackgrounds {
+		var metadata BackgroundMetadata
+		var legacyValue string
+		if json.Unmarshal(rawMetadata, &legacyValue) == nil {
+			// Older versions stored "s" for every background
+			existingBackgrounds[fname] = metadata
+			continue
+		}
+		err = json.Unmarshal(rawMetadata, &metadata)
+		if err != nil {
+			eb.logger.Warn(fmt.Sprintf("failed to unmarshall metadata of existing image '%s'", fname), zap.Error(err))
+		}
+		existingBackgrounds[fname] = metadata
+	}
+	return existingBackgrounds
 }
 
-func (eb *ExistingBackgrounds) AddBackground(backgroundFname string) {
-	(*eb.existingBackgrounds)[backgroundFname] = "s"
+func (eb *ExistingBackgrounds) AddBackground(backgroundFname string, metadata BackgroundMetadata) {
+	eb.existingBackgrounds[backgroundFname] = metadata
 }
 
 func (eb *ExistingBackgrounds) HasBackground(backgroundFname string) bool {
-	if _, ok := (*eb.existingBackgrounds)[backgroundFname]; ok {
+	if _, ok := eb.existingBackgrounds[backgroundFname]; ok {
 		return true
 	}
 	return false
 }
 
+func (eb *ExistingBackgrounds) RemoveBackground(backgroundFname string) {
+	delete(eb.existingBackgrounds, backgroundFname)
+}
+
+// FindPost returns the file name a post was saved as, the extension depends on the format it was saved in
+func (eb *ExistingBackgrounds) FindPost(postID string) (string, bool) {
+	for fname := range eb.existingBackgrounds {
+		if strings.TrimSuffix(fname, filepath.Ext(fname)) == postID {
+			return fname, true
+		}
+	}
+	return "", false
+}
+
+func (eb *ExistingBackgrounds) GetBackground(backgroundFname string) (BackgroundMetadata, bool) {
+	metadata, ok := eb.existingBackgrounds[backgroundFname]
+	return metadata, ok
+}
+
+// Backgrounds returns a copy of the index keyed by file name
+func (eb *ExistingBackgrounds) Backgrounds() map[string]BackgroundMetadata {
+	backgrounds := make(map[string]BackgroundMetadata, len(eb.existingBackgrounds))
+	for fname, metadata := range eb.existingBackgrounds {
+		backgrounds[fname] = metadata
+	}
+	return backgrounds
+}
+
+// SidecarPath is where the metadata of a background is written when sidecars are enabled, e.g. t3_abc.json
+func SidecarPath(backgroundPath string) string {
+	return strings.TrimSuffix(backgroundPath, filepath.Ext(backgroundPath)) + ".json"
+}
+
+func writeSidecar(backgroundPath string, metadata BackgroundMetadata) error {
+	out, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshall sidecar metadata: %v", err)
+	}
+	return ioutil.WriteFile(SidecarPath(backgroundPath), out, 0644)
+}
+
+// ReadSidecar returns os.ErrNotExist when the background has no sidecar
+func ReadSidecar(backgroundPath string) (BackgroundMetadata, error) {
+	var metadata BackgroundMetadata
+	byteValue, err := ioutil.ReadFile(SidecarPath(backgroundPath))
+	if err != nil {
+		return metadata, err
+	}
+	err = json.Unmarshal(byteValue, &metadata)
+	if err != nil {
+		return metadata, fmt.Errorf("failed to unmarshall sidecar metadata: %v", err)
+	}
+	return metadata, nil
+}
+
 func (eb *ExistingBackgrounds) SaveExistingBackgrounds() error {
-	err := file_readers.SaveMapAsJson(*eb.existingBackgrounds, eb.fpath)
+	out, err := json.Marshal(eb.existingBackgrounds)
+	if err == nil {
+		err = ioutil.WriteFile(eb.fpath, out, 0644)
+	}
 	if err != nil {
 		eb.logger.Error(fmt.Sprintf("failed to save existing background file to '%s'", eb.fpath))
 		return err
 	}
 	eb.logger.Info(fmt.Sprintf("saved existing backgrounds file to '%s'", eb.fpath))
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,67 @@
+package reddit_cli
+
+import (
+	"earthpullr/pkg/image_format"
+	"fmt"
+	"go.uber.org/zap"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// placeholderURLs are served by image hosts in place of removed images, they're matched against the URL redirected to
+// e.g. https://i.imgur.com/removed.png and https://s.yimg.com/pw/images/en-us/photo_unavailable.png
+var placeholderURLs = []string{
+	"/removed.png",
+	"/photo_unavailable",
+}
+
+// responseRejectionReason checks the response to an image request before anything is written to disk, so login walls,
+// error pages and placeholders for removed images are never saved. Header is the start of the body.
+func responseRejectionReason(logger *zap.Logger, uid string, res *http.Response, header []byte) string {
+	finalURL := res.Request.URL.String()
+	for _, placeholder := range placeholderURLs {
+		if strings.Contains(finalURL, placeholder) {
+			logger.Debug(fmt.Sprintf("Image '%s' has been removed, got the placeholder '%s'", uid, finalURL))
+			return rejectedPlaceholder
+		}
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		logger.Debug(fmt.Sprintf("Image '%s' request failed with status %d", uid, res.StatusCode))
+		return rejectedHTTPStatus
+	}
+	contentType := res.Header.Get("Content-Type")
+	if !isImageContentType(contentType) {
+		logger.Debug(fmt.Sprintf("Image '%s' was served as '%s' rather than an image", uid, contentType))
+		return rejectedContentType
+	}
+	if image_format.Sniff(header) == "" {
+		logger.Debug(fmt.Sprintf("Image '%s' served as '%s' is not a supported image", uid, contentType))
+		return rejectedContentType
+	}
+	return ""
+}
+
+// isImageContentType allows a missing or generic binary Content-Type as some hosts don't set one, the magic bytes are
+// still checked
+func isImageContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/octet-stream", "binary/octet-stream":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "image/")
+}
+
+// urlHasImageExtension is true when the path of the URL, ignoring its query, ends with a supported image extension
+func urlHasImageExtension(rawURL string) bool {
+	ext := strings.ToLower(path.Ext(strings.SplitN(strings.SplitN(rawURL, "?", 2)[0], "#", 2)[0]))
+	return image_format.FormatOfExtension(ext) != ""
+}
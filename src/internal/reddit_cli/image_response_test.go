@@ -0,0 +1,50 @@
+package reddit_cli
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestResponseRejectionReason(t *testing.T) {
+	jpegHeader := []byte{0xff, 0xd8, 0xff, 0xe0}
+	tests := []struct {
+		name        string
+		url         string
+		status      int
+		contentType string
+		header      []byte
+		want        string
+	}{
+		{"image", "https://i.redd.it/abc.jpg", http.StatusOK, "image/jpeg", jpegHeader, ""},
+		{"missing content type", "https://i.redd.it/abc.jpg", http.StatusOK, "", jpegHeader, ""},
+		{"octet stream", "https://i.redd.it/abc.jpg", http.StatusOK, "application/octet-stream", jpegHeader, ""},
+		{"removed placeholder", "https://i.imgur.com/removed.png", http.StatusOK, "image/png", jpegHeader, rejectedPlaceholder},
+		{"not found", "https://i.redd.it/abc.jpg", http.StatusNotFound, "image/jpeg", jpegHeader, rejectedHTTPStatus},
+		{"forbidden error page", "https://i.redd.it/abc.jpg", http.StatusForbidden, "text/html", []byte("<html>"), rejectedHTTPStatus},
+		{"login wall", "https://www.reddit.com/login", http.StatusOK, "text/html; charset=utf-8", []byte("<html>"), rejectedContentType},
+		{"image content type with html body", "https://i.redd.it/abc.jpg", http.StatusOK, "image/jpeg", []byte("<html>"), rejectedContentType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reqURL, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := &http.Response{
+				StatusCode: test.status,
+				Header:     http.Header{},
+				Request:    &http.Request{URL: reqURL},
+			}
+			if test.contentType != "" {
+				res.Header.Set("Content-Type", test.contentType)
+			}
+			got := responseRejectionReason(zap.NewNop(), "t3_abc", res, test.header)
+			if got != test.want {
+				t.Fatalf("got '%s', want '%s'", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package reddit_cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"earthpullr/internal/user_settings"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveVersion must be bumped whenever the files of an archive change in a way older versions can't import
+const archiveVersion = 1
+
+// maxArchiveFileBytes caps each file read from an archive, the download index is by far the largest
+const maxArchiveFileBytes = 64 << 20
+
+// Files within a library archive, the downloaded images aren't included and should be copied separately
+const (
+	archiveManifestFname = "manifest.json"
+	archiveConfigFname   = "config.json"
+	archiveSettingsFname = "user_settings.json"
+	archiveCurationFname = "curation.json"
+	archiveIndexFname    = "existing_images.json"
+)
+
+type archiveManifest struct {
+	Version      int       `json:"version"`
+	AppVersion   string    `json:"app_version"`
+	ExportedAt   time.Time `json:"exported_at"`
+	DownloadPath string    `json:"download_path"`
+}
+
+type ExportRequest struct {
+	ArchivePath string
+	// DownloadPath is the library whose index is exported, it defaults to the download path of the user settings
+	DownloadPath string
+}
+
+type ImportRequest struct {
+	ArchivePath string
+	// DownloadPath is where the library now lives, it defaults to the download path of the user settings and then to
+	// that of the archive. Favourites within the archive's download path are moved to it.
+	DownloadPath string
+	// ConfigPath is where the archive's config is written, it isn't imported when empty
+	ConfigPath string
+	// ReplaceSettings replaces the user settings with the archive's, otherwise they only fill in unset settings
+	ReplaceSettings bool
+	WaitForLock     bool
+}
+
+type ImportReport struct {
+	DownloadPath string `json:"download_path"`
+	// PreviousDownloadPath is the download path the archive was exported from
+	PreviousDownloadPath string `json:"previous_download_path"`
+	AddedBackgrounds     int    `json:"added_backgrounds"`
+	DuplicateBackgrounds int    `json:"duplicate_backgrounds"`
+	AddedCuration        int    `json:"added_curation"`
+	ConfigPath           string `json:"config_path,omitempty"`
+}
+
+// ExportLibrary writes the config, user settings, favourites, bans and download index into a single archive so a
+// library can be moved to another machine
+func (br *BackgroundRetriever) ExportLibrary(request map[string]interface{}) error {
+	var exportRequest ExportRequest
+	err := mapstructure.Decode(request, &exportRequest)
+	if err != nil {
+		return fmt.Errorf("failed to decode export request from frontend: %v", err)
+	}
+	if exportRequest.ArchivePath == "" {
+		return fmt.Errorf("no archive path has been set")
+	}
+	if exportRequest.DownloadPath == "" {
+		exportRequest.DownloadPath = br.settings().DownloadPath
+	}
+	file, err := os.Create(exportRequest.ArchivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive '%s': %v", exportRequest.ArchivePath, err)
+	}
+	err = br.writeArchive(file, exportRequest.DownloadPath)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(exportRequest.ArchivePath)
+		return fmt.Errorf("failed to export library to '%s': %v", exportRequest.ArchivePath, err)
+	}
+	br.logger.Info(fmt.Sprintf("Exported library to '%s'", exportRequest.ArchivePath), zap.String("download_path", exportRequest.DownloadPath))
+	return nil
+}
+
+func (br *BackgroundRetriever) writeArchive(w io.Writer, downloadPath string) error {
+	archive := zip.NewWriter(w)
+	manifest := archiveManifest{
+		Version:      archiveVersion,
+		AppVersion:   br.conf.Version,
+		ExportedAt:   time.Now().UTC(),
+		DownloadPath: downloadPath,
+	}
+	err := writeArchiveJson(archive, archiveManifestFname, manifest.ExportedAt, manifest)
+	if err != nil {
+		return err
+	}
+	err = writeArchiveJson(archive, archiveConfigFname, manifest.ExportedAt, br.conf)
+	if err != nil {
+		return err
+	}
+	err = writeArchiveJson(archive, archiveSettingsFname, manifest.ExportedAt, br.settings())
+	if err != nil {
+		return err
+	}
+	curationFile, err := createArchiveFile(archive, archiveCurationFname, manifest.ExportedAt)
+	if err != nil {
+		return err
+	}
+	err = br.curation.Export(curationFile)
+	if err != nil {
+		return err
+	}
+	backgrounds := map[string]BackgroundMetadata{}
+	if downloadPath != "" {
+		backgrounds = NewExistingBackgrounds(downloadPath, br.conf.ExistingImagesFilename, br.logger).Backgrounds()
+	}
+	err = writeArchiveJson(archive, archiveIndexFname, manifest.ExportedAt, backgrounds)
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func createArchiveFile(archive *zip.Writer, fname string, modified time.Time) (io.Writer, error) {
+	return archive.CreateHeader(&zip.FileHeader{Name: fname, Method: zip.Deflate, Modified: modified})
+}
+
+func writeArchiveJson(archive *zip.Writer, fname string, modified time.Time, value interface{}) error {
+	out, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshall '%s': %v", fname, err)
+	}
+	file, err := createArchiveFile(archive, fname, modified)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(out)
+	return err
+}
+
+// ImportLibrary merges an archive written by ExportLibrary into this library. The archive's user settings fill in
+// those left unset unless replacing them is requested, the download path is never taken from them. Favourites, bans
+// and index entries already present are kept as they are. Backgrounds missing from the download directory can be
+// downloaded again by verifying it.
+func (br *BackgroundRetriever) ImportLibrary(request map[string]interface{}) (ImportReport, error) {
+	err := br.acquire()
+	if err != nil {
+		return ImportReport{}, err
+	}
+	defer br.release()
+	var importRequest ImportRequest
+	err = mapstructure.Decode(request, &importRequest)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("failed to decode import request from frontend: %v", err)
+	}
+	archive, err := zip.OpenReader(importRequest.ArchivePath)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("failed to open archive '%s': %v", importRequest.ArchivePath, err)
+	}
+	defer archive.Close()
+	files, err := readArchiveFiles(&archive.Reader, maxArchiveFileBytes)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("failed to read archive '%s': %v", importRequest.ArchivePath, err)
+	}
+	var manifest archiveManifest
+	err = json.Unmarshal(files[archiveManifestFname], &manifest)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("failed to unmarshall archive manifest: %v", err)
+	}
+	if manifest.Version > archiveVersion {
+		return ImportReport{}, fmt.Errorf("archive version %d is newer than the supported version %d", manifest.Version, archiveVersion)
+	}
+	settings, err := user_settings.ParseUserSettings(files[archiveSettingsFname])
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	report := ImportReport{DownloadPath: importRequest.DownloadPath, PreviousDownloadPath: manifest.DownloadPath}
+	if report.DownloadPath == "" {
+		report.DownloadPath = br.settings().DownloadPath
+	}
+	if report.DownloadPath == "" {
+		report.DownloadPath = manifest.DownloadPath
+	}
+	if report.DownloadPath == "" {
+		return report, fmt.Errorf("no download path has been set")
+	}
+	err = os.MkdirAll(report.DownloadPath, 0755)
+	if err != nil {
+		return report, fmt.Errorf("failed to create download path '%s': %v", report.DownloadPath, err)
+	}
+	lock, err := br.lockDownloadPath(report.DownloadPath, importRequest.WaitForLock)
+	if err != nil {
+		return report, err
+	}
+	defer br.unlockDownloadPath(lock)
+
+	if importRequest.ConfigPath != "" {
+		err = writeImportedConfig(importRequest.ConfigPath, files[archiveConfigFname])
+		if err != nil {
+			return report, err
+		}
+		report.ConfigPath = importRequest.ConfigPath
+	}
+	if !importRequest.ReplaceSettings {
+		settings = br.settings().Merge(settings)
+	}
+	settings.DownloadPath = report.DownloadPath
+	err = br.updateSettings(settings)
+	if err != nil {
+		return report, fmt.Errorf("failed to import user settings: %v", err)
+	}
+	report.AddedCuration, err = br.curation.Merge(bytes.NewReader(files[archiveCurationFname]), func(fpath string) string {
+		return remapPath(fpath, manifest.DownloadPath, report.DownloadPath)
+	})
+	if err != nil {
+		return report, err
+	}
+	err = br.mergeIndex(files[archiveIndexFname], report.DownloadPath, &report)
+	if err != nil {
+		return report, err
+	}
+	br.logger.Info(fmt.Sprintf("Imported library from '%s'", importRequest.ArchivePath), zap.Any("report", report))
+	return report, nil
+}
+
+// readArchiveFiles returns the contents of the files of an archive, every file is required and none may be larger
+// than maxBytes. Other files are ignored.
+func readArchiveFiles(archive *zip.Reader, maxBytes int64) (map[string][]byte, error) {
+	fnames := []string{archiveManifestFname, archiveConfigFname, archiveSettingsFname, archiveCurationFname, archiveIndexFname}
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		if !contains(fnames, file.Name) {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		// The size in the header can't be trusted so the read is limited too
+		content, err := ioutil.ReadAll(io.LimitReader(reader, maxBytes+1))
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(content)) > maxBytes {
+			return nil, fmt.Errorf("'%s' is larger than the limit of %d bytes", file.Name, maxBytes)
+		}
+		files[file.Name] = content
+	}
+	for _, fname := range fnames {
+		if _, ok := files[fname]; !ok {
+			return nil, fmt.Errorf("'%s' is missing, it may not be an earthpullr library archive", fname)
+		}
+	}
+	return files, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeImportedConfig won't replace an existing config as it may hold settings specific to this machine
+func writeImportedConfig(configPath string, config []byte) error {
+	file, err := os.OpenFile(configPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("config '%s' already exists, choose another path for the imported config", configPath)
+	} else if err != nil {
+		return fmt.Errorf("failed to create config '%s': %v", configPath, err)
+	}
+	_, err = file.Write(config)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config '%s': %v", configPath, err)
+	}
+	return nil
+}
+
+// mergeIndex adds the backgrounds of the archive's index which aren't already downloaded under any name
+func (br *BackgroundRetriever) mergeIndex(index []byte, downloadPath string, report *ImportReport) error {
+	var backgrounds map[string]BackgroundMetadata
+	err := json.Unmarshal(index, &backgrounds)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshall archive download index: %v", err)
+	}
+	existingBackgrounds := NewExistingBackgrounds(downloadPath, br.conf.ExistingImagesFilename, br.logger)
+	for fname, metadata := range backgrounds {
+		postID := metadata.PostID
+		if postID == "" {
+			postID = strings.TrimSuffix(fname, filepath.Ext(fname))
+		}
+		if _, found := existingBackgrounds.FindPost(postID); found || existingBackgrounds.HasBackground(fname) {
+			report.DuplicateBackgrounds++
+			continue
+		}
+		existingBackgrounds.AddBackground(fname, metadata)
+		report.AddedBackgrounds++
+	}
+	if report.AddedBackgrounds == 0 {
+		return nil
+	}
+	return existingBackgrounds.SaveExistingBackgrounds()
+}
+
+// remapPath moves a path within the old download path to the same place within the new one, other paths are kept
+func remapPath(fpath string, oldDownloadPath string, newDownloadPath string) string {
+	if oldDownloadPath == "" || oldDownloadPath == newDownloadPath {
+		return fpath
+	}
+	rel, err := filepath.Rel(oldDownloadPath, fpath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fpath
+	}
+	return filepath.Join(newDownloadPath, rel)
+}
@@ -0,0 +1,187 @@
+package reddit_cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"earthpullr/internal/user_settings"
+	"earthpullr/pkg/mock_reddit"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestExportImportLibrary(t *testing.T) {
+	source, _, sourcePath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	_, err := source.FetchBackgrounds(testRequest(sourcePath, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := savedImages(t, sourcePath)
+	err = source.FavouriteBackground(filepath.Join(sourcePath, images[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceSettings := user_settings.UserSettings{
+		DownloadPath:     sourcePath,
+		Width:            fixtureWidth,
+		Height:           fixtureHeight,
+		BackgroundsCount: 5,
+		Filters:          user_settings.Filters{Brightness: user_settings.BrightnessDark},
+	}
+	err = source.updateSettings(sourceSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "library.zip")
+	err = source.ExportLibrary(map[string]interface{}{"ArchivePath": archivePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, _, targetPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	err = target.updateSettings(user_settings.UserSettings{Width: 1920, Height: 1080})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := target.ImportLibrary(map[string]interface{}{"ArchivePath": archivePath, "DownloadPath": targetPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.AddedBackgrounds != 3 || report.DuplicateBackgrounds != 0 || report.AddedCuration != 1 || report.PreviousDownloadPath != sourcePath {
+		t.Fatalf("got report %+v", report)
+	}
+	index := NewExistingBackgrounds(targetPath, target.conf.ExistingImagesFilename, zap.NewNop())
+	for _, fname := range images {
+		if !index.HasBackground(fname) {
+			t.Fatalf("expected '%s' to be imported into the index", fname)
+		}
+	}
+	favourites := target.GetFavourites()
+	if len(favourites) != 1 || favourites[0].FilePath != filepath.Join(targetPath, images[0]) {
+		t.Fatalf("expected the favourite to be moved to the new download path, got %+v", favourites)
+	}
+	settings := target.GetSettings()
+	if settings.Width != 1920 || settings.Height != 1080 {
+		t.Fatalf("expected the resolution already set to be kept, got %dx%d", settings.Width, settings.Height)
+	}
+	if settings.BackgroundsCount != 5 || settings.Filters.Brightness != user_settings.BrightnessDark || settings.DownloadPath != targetPath {
+		t.Fatalf("expected unset settings to be filled in from the archive, got %+v", settings)
+	}
+
+	report, err = target.ImportLibrary(map[string]interface{}{"ArchivePath": archivePath, "DownloadPath": targetPath, "ReplaceSettings": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.AddedBackgrounds != 0 || report.DuplicateBackgrounds != 3 || report.AddedCuration != 0 {
+		t.Fatalf("expected importing again to add nothing, got %+v", report)
+	}
+	settings = target.GetSettings()
+	if settings.Width != fixtureWidth || settings.Height != fixtureHeight || settings.DownloadPath != targetPath {
+		t.Fatalf("expected the settings apart from the download path to be replaced, got %+v", settings)
+	}
+}
+
+func TestMergeIndex(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	existing := NewExistingBackgrounds(downloadPath, retriever.conf.ExistingImagesFilename, zap.NewNop())
+	existing.AddBackground("t3_a.jpg", BackgroundMetadata{PostID: "t3_a"})
+	existing.AddBackground("t3_c.jpg", BackgroundMetadata{PostID: "t3_c"})
+	err := existing.SaveExistingBackgrounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := json.Marshal(map[string]BackgroundMetadata{
+		// The same post saved in another format
+		"t3_a.png": {PostID: "t3_a"},
+		// An entry from before post IDs were recorded, named by its post
+		"t3_b.jpg": {},
+		// A post already downloaded under a different name
+		"Lake_Tekapo.jpg": {PostID: "t3_c"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report ImportReport
+	err = retriever.mergeIndex(index, downloadPath, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.AddedBackgrounds != 1 || report.DuplicateBackgrounds != 2 {
+		t.Fatalf("got %d added and %d duplicates, want 1 and 2", report.AddedBackgrounds, report.DuplicateBackgrounds)
+	}
+	merged := NewExistingBackgrounds(downloadPath, retriever.conf.ExistingImagesFilename, zap.NewNop()).Backgrounds()
+	if len(merged) != 3 {
+		t.Fatalf("got index %v, want t3_b.jpg added", merged)
+	}
+	if _, ok := merged["t3_b.jpg"]; !ok {
+		t.Fatalf("got index %v, want t3_b.jpg added", merged)
+	}
+}
+
+func TestRemapPath(t *testing.T) {
+	oldPath := filepath.Join(string(filepath.Separator), "home", "old", "backgrounds")
+	newPath := filepath.Join(string(filepath.Separator), "data", "backgrounds")
+	tests := []struct {
+		name    string
+		fpath   string
+		oldPath string
+		want    string
+	}{
+		{name: "within", fpath: filepath.Join(oldPath, "t3_a.jpg"), oldPath: oldPath, want: filepath.Join(newPath, "t3_a.jpg")},
+		{name: "nested", fpath: filepath.Join(oldPath, "saved", "t3_a.jpg"), oldPath: oldPath, want: filepath.Join(newPath, "saved", "t3_a.jpg")},
+		{name: "outside", fpath: filepath.Join(string(filepath.Separator), "home", "old", "t3_a.jpg"), oldPath: oldPath, want: filepath.Join(string(filepath.Separator), "home", "old", "t3_a.jpg")},
+		{name: "sibling with the same prefix", fpath: oldPath + "-2" + string(filepath.Separator) + "t3_a.jpg", oldPath: oldPath, want: oldPath + "-2" + string(filepath.Separator) + "t3_a.jpg"},
+		{name: "no old path", fpath: filepath.Join(oldPath, "t3_a.jpg"), oldPath: "", want: filepath.Join(oldPath, "t3_a.jpg")},
+		{name: "unchanged path", fpath: filepath.Join(newPath, "t3_a.jpg"), oldPath: newPath, want: filepath.Join(newPath, "t3_a.jpg")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := remapPath(test.fpath, test.oldPath, newPath); got != test.want {
+				t.Fatalf("got '%s', want '%s'", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadArchiveFilesLimitsSize(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, fname := range []string{archiveManifestFname, archiveConfigFname, archiveSettingsFname, archiveCurationFname, archiveIndexFname, "unrelated.bin"} {
+		content := "{}"
+		if fname == archiveIndexFname || fname == "unrelated.bin" {
+			content = strings.Repeat(" ", 1024)
+		}
+		file, err := archive.Create(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := readArchiveFiles(reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["unrelated.bin"]; ok {
+		t.Fatal("expected files other than the library's to be ignored")
+	}
+	_, err = readArchiveFiles(reader, 1023)
+	if err == nil || !strings.Contains(err.Error(), archiveIndexFname) {
+		t.Fatalf("expected the index to be over the limit, got %v", err)
+	}
+}
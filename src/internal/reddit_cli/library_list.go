@@ -0,0 +1,51 @@
+package reddit_cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LibraryBackground is a downloaded background with its metadata from the index
+type LibraryBackground struct {
+	File      string `json:"file"`
+	Path      string `json:"path"`
+	Favourite bool   `json:"favourite"`
+	BackgroundMetadata
+}
+
+// ListLibrary returns the backgrounds of the download path, which defaults to that of the user settings, newest first.
+// Backgrounds missing from the download directory are left out.
+func (br *BackgroundRetriever) ListLibrary(downloadPath string) ([]LibraryBackground, error) {
+	if downloadPath == "" {
+		downloadPath = br.settings().DownloadPath
+	}
+	if downloadPath == "" {
+		return nil, fmt.Errorf("no download path has been set")
+	}
+	if _, err := os.Stat(downloadPath); err != nil {
+		return nil, fmt.Errorf("failed to read download path '%s': %v", downloadPath, err)
+	}
+	library := []LibraryBackground{}
+	backgrounds := NewExistingBackgrounds(downloadPath, br.conf.ExistingImagesFilename, br.logger).Backgrounds()
+	for fname, metadata := range backgrounds {
+		fpath := filepath.Join(downloadPath, fname)
+		if _, err := os.Stat(fpath); err != nil {
+			continue
+		}
+		library = append(library, LibraryBackground{
+			File:               fname,
+			Path:               fpath,
+			Favourite:          metadata.PostID != "" && br.curation.IsFavourite(metadata.PostID),
+			BackgroundMetadata: metadata,
+		})
+	}
+	sort.Slice(library, func(i, j int) bool {
+		if !library[i].SavedAt.Equal(library[j].SavedAt) {
+			return library[i].SavedAt.After(library[j].SavedAt)
+		}
+		return library[i].File < library[j].File
+	})
+	return library, nil
+}
@@ -0,0 +1,265 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/listing_sources"
+	"earthpullr/internal/title_parser"
+	"earthpullr/pkg/image_format"
+	"earthpullr/pkg/xmp"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fixes made when verifying a download directory
+const (
+	fixRemovedMissing   = "removed_missing"
+	fixRemovedCorrupt   = "removed_corrupt"
+	fixRemovedPartial   = "removed_partial_download"
+	fixAdopted          = "adopted"
+	fixCorruptOrphan    = "corrupt_orphan"
+	fixCorruptFavourite = "corrupt_favourite"
+	fixRedownloaded     = "redownloaded"
+	fixRedownloadFailed = "redownload_failed"
+)
+
+type VerifyRequest struct {
+	// DownloadPath defaults to the download path of the user settings
+	DownloadPath string
+	// Redownload downloads the posts of missing and corrupt backgrounds again
+	Redownload  bool
+	WaitForLock bool
+}
+
+type VerifyFix struct {
+	File   string `json:"file"`
+	Fix    string `json:"fix"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type VerifyReport struct {
+	DownloadPath string      `json:"download_path"`
+	Checked      int         `json:"checked"`
+	Fixes        []VerifyFix `json:"fixes"`
+}
+
+func (report *VerifyReport) addFix(file string, fix string, detail string) {
+	report.Fixes = append(report.Fixes, VerifyFix{File: file, Fix: fix, Detail: detail})
+}
+
+// VerifyLibrary reconciles the index of downloaded backgrounds with the files in the download directory. Entries
+// for missing or corrupt files are removed so they can be downloaded again, image files missing from the index are
+// adopted into it and partial downloads are deleted. Orphaned files and favourites which can't be decoded are reported
+// but left alone, as they weren't downloaded by earthpullr or the user chose to keep them.
+func (br *BackgroundRetriever) VerifyLibrary(request map[string]interface{}) (VerifyReport, error) {
+	err := br.acquire()
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	defer br.release()
+	var verifyRequest VerifyRequest
+	err = mapstructure.Decode(request, &verifyRequest)
+	if err != nil {
+		return VerifyReport{}, fmt.Errorf("failed to decode verify request from frontend: %v", err)
+	}
+	if verifyRequest.DownloadPath == "" {
+		verifyRequest.DownloadPath = br.settings().DownloadPath
+	}
+	if verifyRequest.DownloadPath == "" {
+		return VerifyReport{}, fmt.Errorf("no download path has been set")
+	}
+	lock, err := br.lockDownloadPath(verifyRequest.DownloadPath, verifyRequest.WaitForLock)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	defer br.unlockDownloadPath(lock)
+	return br.verifyLibrary(verifyRequest)
+}
+
+func (br *BackgroundRetriever) verifyLibrary(request VerifyRequest) (VerifyReport, error) {
+	report := VerifyReport{DownloadPath: request.DownloadPath, Fixes: []VerifyFix{}}
+	files, err := ioutil.ReadDir(request.DownloadPath)
+	if err != nil {
+		return report, fmt.Errorf("failed to read download directory '%s': %v", request.DownloadPath, err)
+	}
+	existingBackgrounds := NewExistingBackgrounds(request.DownloadPath, br.conf.ExistingImagesFilename, br.logger)
+	backgrounds := existingBackgrounds.Backgrounds()
+	var fnames []string
+	for fname := range backgrounds {
+		fnames = append(fnames, fname)
+	}
+	sort.Strings(fnames)
+
+	var redownloadPostIDs []string
+	for _, fname := range fnames {
+		report.Checked++
+		fpath := filepath.Join(request.DownloadPath, fname)
+		postID := backgrounds[fname].PostID
+		if postID == "" {
+			// Backgrounds downloaded by older versions are named by their post
+			postID, _ = postIDFromPath(fname)
+		}
+		if _, err := os.Stat(fpath); errors.Is(err, os.ErrNotExist) {
+			existingBackgrounds.RemoveBackground(fname)
+			report.addFix(fname, fixRemovedMissing, "")
+			if postID != "" {
+				redownloadPostIDs = append(redownloadPostIDs, postID)
+			}
+			continue
+		}
+		if _, _, decodeErr := image_format.DecodeFile(fpath); decodeErr != nil {
+			if postID != "" && br.curation.IsFavourite(postID) {
+				report.addFix(fname, fixCorruptFavourite, decodeErr.Error())
+				continue
+			}
+			err = removeBackgroundFiles(fpath)
+			if err != nil {
+				return report, err
+			}
+			existingBackgrounds.RemoveBackground(fname)
+			report.addFix(fname, fixRemovedCorrupt, decodeErr.Error())
+			if postID != "" {
+				redownloadPostIDs = append(redownloadPostIDs, postID)
+			}
+		}
+	}
+
+	for _, file := range files {
+		fname := file.Name()
+		fpath := filepath.Join(request.DownloadPath, fname)
+		if file.IsDir() || strings.HasPrefix(fname, ".") {
+			continue
+		}
+		if strings.HasSuffix(fname, downloadSuffix) {
+			err = os.Remove(fpath)
+			if err != nil {
+				return report, fmt.Errorf("failed to remove partial download '%s': %v", fpath, err)
+			}
+			report.addFix(fname, fixRemovedPartial, "")
+			continue
+		}
+		if _, ok := backgrounds[fname]; ok || image_format.FormatOfExtension(strings.ToLower(filepath.Ext(fname))) == "" {
+			continue
+		}
+		report.Checked++
+		img, _, err := image_format.DecodeFile(fpath)
+		if err != nil {
+			report.addFix(fname, fixCorruptOrphan, err.Error())
+			continue
+		}
+		metadata := orphanMetadata(br.logger, fpath, file.ModTime())
+		metadata.Width = img.Bounds().Dx()
+		metadata.Height = img.Bounds().Dy()
+		existingBackgrounds.AddBackground(fname, metadata)
+		report.addFix(fname, fixAdopted, metadata.Title)
+	}
+
+	var redownloadErr error
+	if request.Redownload && len(redownloadPostIDs) > 0 {
+		redownloadErr = br.redownloadPosts(existingBackgrounds, request.DownloadPath, redownloadPostIDs, &report)
+	}
+	// The fixes so far are saved even if downloading again failed
+	err = existingBackgrounds.SaveExistingBackgrounds()
+	if err != nil {
+		return report, err
+	}
+	for _, fix := range report.Fixes {
+		br.logger.Info(fmt.Sprintf("Verified '%s'", fix.File), zap.String("fix", fix.Fix), zap.String("detail", fix.Detail))
+	}
+	if redownloadErr != nil {
+		return report, fmt.Errorf("failed to download missing backgrounds again: %v", redownloadErr)
+	}
+	return report, nil
+}
+
+// orphanMetadata recovers the metadata of an image missing from the index from its sidecar or embedded attribution
+func orphanMetadata(logger *zap.Logger, fpath string, modTime time.Time) BackgroundMetadata {
+	metadata, err := ReadSidecar(fpath)
+	if err == nil {
+		return metadata
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		logger.Warn(fmt.Sprintf("Ignoring the invalid sidecar of '%s'", fpath), zap.Error(err))
+	}
+	metadata = BackgroundMetadata{SavedAt: modTime.UTC()}
+	attribution, err := xmp.Read(fpath)
+	if err != nil {
+		return metadata
+	}
+	metadata.PostID = attribution.PostID
+	metadata.Title = attribution.Title
+	metadata.Author = attribution.Author
+	metadata.Subreddit = attribution.Subreddit
+	metadata.Permalink = attribution.Permalink
+	metadata.SavedAt = attribution.DownloadedAt
+	metadata.TitleMetadata = title_parser.Parse(attribution.Title)
+	metadata.Location = titleLocation(metadata.TitleMetadata)
+	return metadata
+}
+
+func removeBackgroundFiles(fpath string) error {
+	err := os.Remove(fpath)
+	if err != nil {
+		return fmt.Errorf("failed to remove '%s': %v", fpath, err)
+	}
+	err = os.Remove(SidecarPath(fpath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove sidecar of '%s': %v", fpath, err)
+	}
+	return nil
+}
+
+// redownloadPosts looks the posts up by their IDs and downloads them with the user's settings, so posts which no
+// longer match them are not downloaded
+func (br *BackgroundRetriever) redownloadPosts(existingBackgrounds *ExistingBackgrounds, downloadPath string, postIDs []string, report *VerifyReport) error {
+	ctx, err := br.oauthContext()
+	if err != nil {
+		return err
+	}
+	request := br.DefaultBackgroundsRequest()
+	request.BackgroundsCount = len(postIDs)
+	request.DownloadPath = downloadPath
+	request.Sources = nil
+	run, err := br.newRun(request, existingBackgrounds)
+	if err != nil {
+		return err
+	}
+	batchSize := br.conf.QueryBatchSize
+	for start := 0; start < len(postIDs); start += batchSize {
+		end := start + batchSize
+		if end > len(postIDs) {
+			end = len(postIDs)
+		}
+		source := listing_sources.Source{Kind: listing_sources.KindPosts, PostIDs: postIDs[start:end]}
+		listingRequest, err := NewListingRequest(ctx, br.client, br.conf, source, "", "")
+		if err != nil {
+			return err
+		}
+		listingResponse, err := listingRequest.DoRequest()
+		if err != nil {
+			return fmt.Errorf("failed to look up posts: %v", err)
+		}
+		imagesRetriever, err := NewImagesRetriever(br.logger, ctx, listingResponse, source.String(), br.client, end-start, run)
+		if err != nil {
+			return err
+		}
+		err = imagesRetriever.SaveImages(br.runtime)
+		if err != nil {
+			return err
+		}
+	}
+	for _, postID := range postIDs {
+		if fname, ok := existingBackgrounds.FindPost(postID); ok {
+			report.addFix(fname, fixRedownloaded, "")
+		} else {
+			report.addFix(postID, fixRedownloadFailed, "the post was removed or no longer matches the settings")
+		}
+	}
+	return nil
+}
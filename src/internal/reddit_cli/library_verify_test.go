@@ -0,0 +1,93 @@
+package reddit_cli
+
+import (
+	"earthpullr/pkg/mock_reddit"
+	stdimage "image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestVerifyLibrary(t *testing.T) {
+	retriever, _, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, nil)
+	_, err := retriever.FetchBackgrounds(testRequest(downloadPath, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := savedImages(t, downloadPath)
+	missing, corrupt, corruptFavourite := images[0], images[1], images[2]
+	err = os.Remove(filepath.Join(downloadPath, missing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fname := range []string{corrupt, corruptFavourite} {
+		err = ioutil.WriteFile(filepath.Join(downloadPath, fname), []byte("not an image"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = retriever.FavouriteBackground(filepath.Join(downloadPath, corruptFavourite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := "t3_partial.jpg" + downloadSuffix
+	err = ioutil.WriteFile(filepath.Join(downloadPath, partial), []byte("half an image"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unindexed := "Copied_in_[1x1].png"
+	err = writeImage(filepath.Join(downloadPath, unindexed), func(f *os.File) error {
+		return png.Encode(f, stdimage.NewRGBA(stdimage.Rect(0, 0, 1, 1)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := retriever.VerifyLibrary(map[string]interface{}{"DownloadPath": downloadPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixes := map[string]string{}
+	for _, fix := range report.Fixes {
+		fixes[fix.File] = fix.Fix
+	}
+	want := map[string]string{
+		missing:          fixRemovedMissing,
+		corrupt:          fixRemovedCorrupt,
+		corruptFavourite: fixCorruptFavourite,
+		partial:          fixRemovedPartial,
+		unindexed:        fixAdopted,
+	}
+	if len(fixes) != len(want) {
+		t.Fatalf("got fixes %v, want %v", fixes, want)
+	}
+	for fname, fix := range want {
+		if fixes[fname] != fix {
+			t.Fatalf("got fix '%s' for '%s', want '%s'", fixes[fname], fname, fix)
+		}
+	}
+
+	for _, fname := range []string{corrupt, partial} {
+		if _, err := os.Stat(filepath.Join(downloadPath, fname)); !os.IsNotExist(err) {
+			t.Fatalf("expected '%s' to be deleted, got %v", fname, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(downloadPath, corruptFavourite)); err != nil {
+		t.Fatalf("expected the corrupt favourite to be kept, got %v", err)
+	}
+	index := NewExistingBackgrounds(downloadPath, retriever.conf.ExistingImagesFilename, zap.NewNop())
+	for _, fname := range []string{missing, corrupt} {
+		if index.HasBackground(fname) {
+			t.Fatalf("expected '%s' to be removed from the index", fname)
+		}
+	}
+	for _, fname := range []string{corruptFavourite, unindexed} {
+		if !index.HasBackground(fname) {
+			t.Fatalf("expected '%s' to be indexed", fname)
+		}
+	}
+}
@@ -1,90 +1,294 @@
 package reddit_cli
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"earthpullr/internal/curation"
+	"earthpullr/internal/gazetteer"
+	"earthpullr/internal/metrics"
+	"earthpullr/internal/title_parser"
+	"earthpullr/pkg/http_retry"
+	"earthpullr/pkg/image_colour"
+	"earthpullr/pkg/image_format"
+	"earthpullr/pkg/image_hash"
+	"earthpullr/pkg/xmp"
+	"errors"
 	"fmt"
 	"github.com/wailsapp/wails"
 	"go.uber.org/zap"
 	"html"
+	// The package declares its own image type for listing previews
+	stdimage "image"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 )
 
 const MAX_RES = 7680 // 8K
 const ACCEPTABLE_ASPECT_DIFF = 0.25
 
+// Reasons an image from a listing is not downloaded
+const (
+	rejectedNotImage            = "not_image"
+	rejectedUnsupportedType     = "unsupported_type"
+	rejectedContentType         = "content_type"
+	rejectedHTTPStatus          = "http_status"
+	rejectedPlaceholder         = "placeholder"
+	rejectedResolution          = "resolution"
+	rejectedAspectRatio         = "aspect_ratio"
+	rejectedAlreadyDownloaded   = "already_downloaded"
+	rejectedBanned              = "banned"
+	rejectedTitleExcluded       = "title_excluded"
+	rejectedTitleNotIncluded    = "title_not_included"
+	rejectedLocationExcluded    = "location_excluded"
+	rejectedLocationNotIncluded = "location_not_included"
+	rejectedBrightness          = "brightness"
+	rejectedColour              = "colour"
+)
+
 type ListingsImagesRetriever struct {
 	logger        *zap.Logger
+	source        string
 	requests      map[imageData]*http.Request
 	client        *http.Client
+	run           *backgroundsRun
 	imageCount    int
 	finalImageUID string
 }
 
 type imageData struct {
-	URL    string
-	Title  string
-	UID    string
-	Width  int
-	Height int
-}
-
-func (image imageData) getImageFileType() (string, error) {
-	switch url := image.URL; {
-	case strings.Contains(url, ".jpg"):
-		return ".jpg", nil
-	case strings.Contains(url, ".png"):
-		return ".png", nil
-	default:
-		return "", fmt.Errorf("unknown file type for image with url: %s", url)
-	}
+	URL       string
+	Title     string
+	UID       string
+	Subreddit string
+	Author    string
+	Domain    string
+	Width     int
+	Height    int
+	Permalink string
+	Metadata  title_parser.TitleMetadata
+	// Location is a pointer as imageData is used as a map key, it's nil when the title doesn't mention a known place
+	Location *gazetteer.Location
 }
 
-func (image imageData) getImageName() (fileType string, err error) {
-	fileType, err = image.getImageFileType()
-	return image.UID + fileType, err
+// redditWebsite is prefixed to the relative permalinks of posts
+const redditWebsite = "https://www.reddit.com"
+
+func (image imageData) backgroundMetadata(source string) BackgroundMetadata {
+	return BackgroundMetadata{
+		PostID:        image.UID,
+		Title:         image.Title,
+		Subreddit:     image.Subreddit,
+		Author:        image.Author,
+		Permalink:     image.Permalink,
+		Source:        source,
+		Width:         image.Width,
+		Height:        image.Height,
+		SavedAt:       time.Now().UTC(),
+		TitleMetadata: image.Metadata,
+		Location:      image.Location,
+	}
 }
 
-func (retriever ListingsImagesRetriever) saveResponseToFile(filePath string, res *http.Response) error {
-	defer res.Body.Close()
+func saveBodyToFile(filePath string, body io.Reader) (int64, error) {
 	file, err := os.Create(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to create file '%s', reason: %v", filePath, err)
+		return 0, fmt.Errorf("failed to create file '%s', reason: %w", filePath, err)
 	}
 	defer file.Close()
-	_, err = io.Copy(file, res.Body)
+	written, err := io.Copy(file, body)
 	if err != nil {
-		return fmt.Errorf("failed to save bytes to file '%s', reason: %v", filePath, err)
+		return written, fmt.Errorf("failed to save bytes to file '%s', reason: %w", filePath, err)
 	}
-	return nil
+	return written, nil
 }
 
-func (retriever ListingsImagesRetriever) SaveImages(directoryPath string, runtime *wails.Runtime, existingBackgrounds *ExistingBackgrounds) error {
+// downloadImage passes the response body to save, or returns a rejection reason without calling it when the response
+// isn't an image
+func (retriever ListingsImagesRetriever) downloadImage(image imageData, request *http.Request, save func(body io.Reader) (int64, error)) (string, error) {
+	start := time.Now()
+	res, err := http_retry.Do(retriever.client, request, retriever.run.retryPolicy, metrics.RetryObserver("image"))
+	if err != nil {
+		metrics.ImageDownloads.WithLabelValues(retriever.source, image.Subreddit, metrics.StatusError).Inc()
+		return "", fmt.Errorf("failed to download with URL '%s', reason: %v", image.URL, err)
+	}
+	metrics.ImageDownloads.WithLabelValues(retriever.source, image.Subreddit, metrics.Status(res.StatusCode, nil)).Inc()
+	defer res.Body.Close()
+	limitedBody := retriever.run.limiter.Reader(request.Context(), res.Body)
+	// Peeking at a rejected response is throttled too
+	defer func() { retriever.run.addThrottled(limitedBody.Throttled()) }()
+	body := bufio.NewReader(limitedBody)
+	// A short body fails the check below so the error can be ignored
+	header, _ := body.Peek(image_format.SniffLen)
+	if reason := responseRejectionReason(retriever.logger, image.UID, res, header); reason != "" {
+		return reason, nil
+	}
+	written, err := save(body)
+	metrics.ImageDownloadBytes.WithLabelValues(retriever.source, image.Subreddit).Add(float64(written))
+	metrics.ImageDownloadDuration.WithLabelValues(retriever.source, image.Subreddit).Observe(time.Since(start).Seconds())
+	return "", err
+}
+
+func (retriever ListingsImagesRetriever) SaveImages(runtime *wails.Runtime) error {
+	if retriever.run.request.DryRun {
+		return retriever.findCandidates()
+	}
+	directoryPath := retriever.run.request.DownloadPath
 	for image, request := range retriever.requests {
-		fileName, err := image.getImageName()
+		downloadPath := filepath.Join(directoryPath, image.UID+downloadSuffix)
+		reason, err := retriever.downloadImage(image, request, func(body io.Reader) (int64, error) {
+			return saveBodyToFile(downloadPath, body)
+		})
 		if err != nil {
-			return fmt.Errorf("failed to save image locally for url '%s': %v", image.URL, err)
+			os.Remove(downloadPath)
+			return err
 		}
-		filePath := filepath.Join(directoryPath, fileName)
-
-		res, err := retriever.client.Do(request)
+		if reason != "" {
+			metrics.ImageRejections.WithLabelValues(retriever.source, image.Subreddit, reason).Inc()
+			retriever.run.addRejection(reason)
+			continue
+		}
+		img, format, err := image_format.DecodeFile(downloadPath)
 		if err != nil {
-			return fmt.Errorf("failed to download with URL '%s', reason: %v", image.URL, err)
+			retriever.logger.Warn(fmt.Sprintf("Discarding '%s' as it could not be decoded", image.URL), zap.Error(err))
+			err = retriever.rejectDownloadedImage(downloadPath, image, rejectedUnsupportedType)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		reason, analysis := retriever.downloadedImageRejectionReason(img, image)
+		if reason != "" {
+			err = retriever.rejectDownloadedImage(downloadPath, image, reason)
+			if err != nil {
+				return err
+			}
+			continue
 		}
-		err = retriever.saveResponseToFile(filePath, res)
+		fileName, err := saveInOutputFormat(downloadPath, image.UID, img, format, retriever.run.request.OutputFormat, retriever.run.request.JPEGQuality)
 		if err != nil {
-			return err
+			os.Remove(downloadPath)
+			return fmt.Errorf("failed to save image locally for url '%s': %w", image.URL, err)
+		}
+		filePath := filepath.Join(directoryPath, fileName)
+		metadata := image.backgroundMetadata(retriever.source)
+		metadata.Colour = analysis
+		err = xmp.Embed(filePath, xmp.Attribution{
+			Title:        metadata.Title,
+			Author:       metadata.Author,
+			Subreddit:    metadata.Subreddit,
+			Permalink:    metadata.Permalink,
+			PostID:       metadata.PostID,
+			DownloadedAt: metadata.SavedAt,
+		})
+		if errors.Is(err, xmp.ErrUnsupportedFormat) {
+			retriever.logger.Debug(fmt.Sprintf("Not embedding attribution into '%s' as its format can't hold it", filePath))
+		} else if err != nil {
+			// The image is still usable as a background without its attribution
+			retriever.logger.Warn(fmt.Sprintf("Failed to embed attribution into '%s'", filePath), zap.Error(err))
+		}
+		if retriever.run.writeSidecars {
+			err = writeSidecar(filePath, metadata)
+			if err != nil {
+				retriever.logger.Warn(fmt.Sprintf("Failed to write metadata sidecar for '%s'", filePath), zap.Error(err))
+			}
 		}
 		retriever.logger.Info(fmt.Sprintf("Successfully saved image to '%s'", filePath))
-		existingBackgrounds.AddBackground(fileName)
-		runtime.Events.Emit("image_saved", 1)
+		retriever.run.existingBackgrounds.AddBackground(fileName, metadata)
+		retriever.run.imageSaved(filePath, metadata)
+		retriever.run.hooks.imageSavedHook(request.Context(), directoryPath, filePath, metadata)
+		if runtime != nil {
+			// No runtime is bound when running headless
+			runtime.Events.Emit("image_saved", 1)
+		}
 	}
 	return nil
 }
 
+// findCandidates downloads the images into memory so every filter is applied as it would be when saving them, nothing
+// is written to the download directory or its index
+func (retriever ListingsImagesRetriever) findCandidates() error {
+	for image, request := range retriever.requests {
+		var body bytes.Buffer
+		reason, err := retriever.downloadImage(image, request, body.ReadFrom)
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			var img stdimage.Image
+			img, _, err = image_format.Decode(&body)
+			if err != nil {
+				retriever.logger.Warn(fmt.Sprintf("Discarding '%s' as it could not be decoded", image.URL), zap.Error(err))
+				reason = rejectedUnsupportedType
+			} else {
+				reason, _ = retriever.downloadedImageRejectionReason(img, image)
+				image.Width, image.Height = img.Bounds().Dx(), img.Bounds().Dy()
+			}
+		}
+		if reason != "" {
+			metrics.ImageRejections.WithLabelValues(retriever.source, image.Subreddit, reason).Inc()
+			retriever.run.addRejection(reason)
+			continue
+		}
+		retriever.logger.Info(fmt.Sprintf("Dry run found '%s'", image.Title), zap.String("url", request.URL.String()))
+		retriever.run.summary.Candidates = append(retriever.run.summary.Candidates, Candidate{
+			PostID:    image.UID,
+			Title:     image.Title,
+			URL:       request.URL.String(),
+			Permalink: image.Permalink,
+			Width:     image.Width,
+			Height:    image.Height,
+			Source:    retriever.source,
+		})
+	}
+	return nil
+}
+
+func (retriever ListingsImagesRetriever) rejectDownloadedImage(downloadPath string, image imageData, reason string) error {
+	err := os.Remove(downloadPath)
+	if err != nil {
+		return fmt.Errorf("failed to remove rejected image '%s': %v", downloadPath, err)
+	}
+	metrics.ImageRejections.WithLabelValues(retriever.source, image.Subreddit, reason).Inc()
+	retriever.run.addRejection(reason)
+	return nil
+}
+
+// downloadedImageRejectionReason checks what can only be known once the image has been downloaded, its real
+// resolution, whether it is a repost of a banned image and its colours
+func (retriever ListingsImagesRetriever) downloadedImageRejectionReason(img stdimage.Image, image imageData) (string, *image_colour.Analysis) {
+	// Hosts may serve a small placeholder or a downscaled copy instead of the resolution listed
+	bounds := img.Bounds()
+	decoded := imageData{Width: bounds.Dx(), Height: bounds.Dy()}
+	if !imageAboveMinSize(retriever.logger, decoded, retriever.run.request.Width, retriever.run.request.Height) {
+		return rejectedResolution, nil
+	}
+	bannedPostID := retriever.run.curation.BannedRepostOf(image_hash.DHashImage(img))
+	if bannedPostID != "" {
+		retriever.logger.Debug(fmt.Sprintf("Image '%s' is a repost of banned post '%s'", image.UID, bannedPostID))
+		return rejectedBanned, nil
+	}
+	analysis := image_colour.Analyse(img)
+	return retriever.run.colourFilter.rejectionReason(retriever.logger, image.UID, analysis), &analysis
+}
+
+func imageIsBanned(logger *zap.Logger, image imageData, bans *curation.Manager) bool {
+	switch {
+	case bans.IsBannedPost(image.UID):
+		logger.Debug(fmt.Sprintf("Post '%s' is banned", image.UID))
+	case image.Author != "" && bans.IsBannedAuthor(image.Author):
+		logger.Debug(fmt.Sprintf("Author '%s' of post '%s' is banned", image.Author, image.UID))
+	case image.Domain != "" && bans.IsBannedDomain(image.Domain):
+		logger.Debug(fmt.Sprintf("Domain '%s' of post '%s' is banned", image.Domain, image.UID))
+	default:
+		return false
+	}
+	return true
+}
+
 func imageAboveMinSize(logger *zap.Logger, image imageData, width int, height int) (valid bool) {
 	valid = true
 	if image.Width < width || image.Height < height {
@@ -100,7 +304,7 @@ func imageAboveMinSize(logger *zap.Logger, image imageData, width int, height in
 	return valid
 }
 
-func imageWithinAspectRatioRange(logger *zap.Logger, image imageData, width int, height int) (valid bool) {
+func imageWithinAspectRatioRange(logger *zap.Logger, image imageData, width int, height int, tolerance float64) (valid bool) {
 	valid = true
 	aspectRatio := (float64(image.Width) / float64(image.Height))
 	requiredRatio := (float64(width) / float64(height))
@@ -108,39 +312,81 @@ func imageWithinAspectRatioRange(logger *zap.Logger, image imageData, width int,
 	if aspectDiff < 0.0 {
 		aspectDiff = -aspectDiff
 	}
-	if aspectDiff > float64(ACCEPTABLE_ASPECT_DIFF) {
+	if aspectDiff > tolerance {
 		valid = false
 		logger.Debug(fmt.Sprintf(
 			"Image found with aspect ratio %f, required (+/-%f)%f",
 			aspectRatio,
-			float64(ACCEPTABLE_ASPECT_DIFF),
+			tolerance,
 			requiredRatio,
 		))
 	}
 	return valid
 }
 
-func imageFitsSpecifiedResolution(logger *zap.Logger, image imageData, width int, height int) (valid bool) {
-	valid = imageAboveMinSize(logger, image, width, height)
-	valid = valid && imageWithinAspectRatioRange(logger, image, width, height)
-	return valid
+// imageRejectionReason returns why the image should not be downloaded, or an empty string if it should be
+func imageRejectionReason(logger *zap.Logger, image imageData, run *backgroundsRun) string {
+	brRequest := run.request
+	if imageIsBanned(logger, image, run.curation) {
+		return rejectedBanned
+	}
+	if reason := run.titleFilter.rejectionReason(logger, image.Title); reason != "" {
+		return reason
+	}
+	if reason := run.locationFilter.rejectionReason(logger, image.UID, image.Location); reason != "" {
+		return reason
+	}
+	if !imageAboveMinSize(logger, image, brRequest.Width, brRequest.Height) {
+		return rejectedResolution
+	}
+	if !imageWithinAspectRatioRange(logger, image, brRequest.Width, brRequest.Height, brRequest.Filters.AspectRatioTolerance) {
+		return rejectedAspectRatio
+	}
+	if imageHasBeenDownloaded(logger, image, run.existingBackgrounds) {
+		return rejectedAlreadyDownloaded
+	}
+	return ""
 }
 
 func imageHasBeenDownloaded(logger *zap.Logger, image imageData, existingBackgrounds *ExistingBackgrounds) (exists bool) {
-	fname, err := image.getImageName()
-	if err != nil {
-		return false
-	}
-	if existingBackgrounds.HasBackground(fname) {
+	if fname, ok := existingBackgrounds.FindPost(image.UID); ok {
 		logger.Debug(fmt.Sprintf("Image '%s' already exists in the download directory", fname))
 		return true
 	}
 	return false
 }
 
-func NewImagesRetriever(logger *zap.Logger, ctx context.Context, lres ListingResponse, client *http.Client, maxImages int, width int, height int, existingImages *ExistingBackgrounds) (imagesRetriever ListingsImagesRetriever, err error) {
+// candidateImages returns the images of a post which could be downloaded. When the preview is missing or has been
+// downscaled below the resolution declared in the title, the image the post links to is used with that resolution.
+func candidateImages(post listingChildData, metadata title_parser.TitleMetadata) []image {
+	directImage := image{Source: sourceImage{
+		URL:    post.URL,
+		Width:  metadata.DeclaredWidth,
+		Height: metadata.DeclaredHeight,
+	}}
+	hasDirectImage := metadata.HasDeclaredResolution() && (post.PostHint == postHintImage || urlHasImageExtension(post.URL))
+	if len(post.Preview.ImagesList) == 0 {
+		if hasDirectImage {
+			return []image{directImage}
+		}
+		return nil
+	}
+	var candidates []image
+	for _, preview := range post.Preview.ImagesList {
+		if hasDirectImage && (preview.Source.Width < metadata.DeclaredWidth || preview.Source.Height < metadata.DeclaredHeight) {
+			candidates = append(candidates, directImage)
+			continue
+		}
+		candidates = append(candidates, preview)
+	}
+	return candidates
+}
+
+func NewImagesRetriever(logger *zap.Logger, ctx context.Context, lres ListingResponse, source string, client *http.Client, maxImages int, run *backgroundsRun) (imagesRetriever ListingsImagesRetriever, err error) {
 	var images []imageData
 
+	brRequest := run.request
+	width, height := brRequest.Width, brRequest.Height
 	if width <= 0 || width > MAX_RES || height <= 0 || height > MAX_RES {
 		return imagesRetriever, fmt.Errorf("resolution must be between (1, 1) to (%d, %d), got (%d, %d)", MAX_RES, MAX_RES, width, height)
 	}
@@ -151,18 +397,51 @@ func NewImagesRetriever(logger *zap.Logger, ctx context.Context, lres ListingRes
 			break
 		}
 		image := imageData{
-			UID:   child.Data.Name,
-			Title: child.Data.Title,
+			UID:       child.Data.Name,
+			Title:     child.Data.Title,
+			Subreddit: child.Data.Subreddit,
+			Author:    child.Data.Author,
+			Domain:    child.Data.Domain,
+			Metadata:  title_parser.Parse(child.Data.Title),
+		}
+		image.Location = titleLocation(image.Metadata)
+		if child.Data.Permalink != "" {
+			image.Permalink = redditWebsite + child.Data.Permalink
 		}
 		imagesRetriever.finalImageUID = image.UID
-		for _, imageObj := range child.Data.Preview.ImagesList {
+		if child.Kind != listingKindLink || child.Data.IsSelf {
+			// Comments and text posts can't be used as backgrounds
+			logger.Debug(fmt.Sprintf("Skipping '%s' as it is not an image post", image.UID))
+			metrics.ImageRejections.WithLabelValues(source, image.Subreddit, rejectedNotImage).Inc()
+			run.addRejection(rejectedNotImage)
+			continue
+		}
+		if image.Metadata.HasDeclaredResolution() &&
+			!imageAboveMinSize(logger, imageData{Width: image.Metadata.DeclaredWidth, Height: image.Metadata.DeclaredHeight}, width, height) {
+			logger.Debug(fmt.Sprintf("Skipping '%s' as its declared resolution is too small", image.UID))
+			metrics.ImageRejections.WithLabelValues(source, image.Subreddit, rejectedResolution).Inc()
+			run.addRejection(rejectedResolution)
+			continue
+		}
+		candidates := candidateImages(child.Data, image.Metadata)
+		if len(candidates) == 0 {
+			logger.Debug(fmt.Sprintf("Skipping '%s' as it has no preview or direct image", image.UID))
+			metrics.ImageRejections.WithLabelValues(source, image.Subreddit, rejectedNotImage).Inc()
+			run.addRejection(rejectedNotImage)
+			continue
+		}
+		for _, imageObj := range candidates {
 			image.URL = imageObj.Source.URL
 			image.Width = imageObj.Source.Width
 			image.Height = imageObj.Source.Height
-			if imageFitsSpecifiedResolution(logger, image, width, height) && !imageHasBeenDownloaded(logger, image, existingImages) {
-				images = append(images, image)
-				imageCount += 1
+			reason := imageRejectionReason(logger, image, run)
+			if reason != "" {
+				metrics.ImageRejections.WithLabelValues(source, image.Subreddit, reason).Inc()
+				run.addRejection(reason)
+				continue
 			}
+			images = append(images, image)
+			imageCount += 1
 		}
 	}
 	requests := map[imageData]*http.Request{}
@@ -180,8 +459,10 @@ func NewImagesRetriever(logger *zap.Logger, ctx context.Context, lres ListingRes
 		requests[image] = req
 	}
 	imagesRetriever.logger = logger
+	imagesRetriever.source = source
 	imagesRetriever.requests = requests
 	imagesRetriever.client = client
+	imagesRetriever.run = run
 	imagesRetriever.imageCount = len(requests)
 	return imagesRetriever, err
 }
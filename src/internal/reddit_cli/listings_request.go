@@ -4,6 +4,10 @@ import (
 	"context"
 	reddit_oauth2 "earthpullr/internal/reddit_oauth"
 	"earthpullr/internal/config"
+	"earthpullr/internal/listing_sources"
+	"earthpullr/internal/metrics"
+	"earthpullr/pkg/http_client"
+	"earthpullr/pkg/http_retry"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +15,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ListingRequest struct {
@@ -18,6 +23,7 @@ type ListingRequest struct {
 	client       *http.Client
 	oAuthToken   *reddit_oauth2.OAuthToken
 	request      *http.Request
+	source       listing_sources.Source
 	before       string
 	after        string
 }
@@ -32,15 +38,30 @@ type listingData struct {
 }
 
 type listingChild struct {
+	Kind string           `json:"kind"`
 	Data listingChildData `json:"data"`
 }
 
+// listingKindLink is the kind of posts, user listings such as saved also contain comments
+const listingKindLink = "t3"
+
 type listingChildData struct {
-	Title   string             `json:"title"`
-	Preview imagePreviewParent `json:"preview"`
-	Name    string             `json:"name"`
+	Title     string             `json:"title"`
+	Preview   imagePreviewParent `json:"preview"`
+	Name      string             `json:"name"`
+	Subreddit string             `json:"subreddit"`
+	IsSelf    bool               `json:"is_self"`
+	Author    string             `json:"author"`
+	Domain    string             `json:"domain"`
+	// URL is what the post links to, for image posts this is the original image
+	URL       string `json:"url"`
+	Permalink string `json:"permalink"`
+	PostHint  string `json:"post_hint"`
 }
 
+// postHintImage is set by reddit on posts linking directly to an image
+const postHintImage = "image"
+
 type imagePreviewParent struct {
 	ImagesList []image `json:"images"`
 }
@@ -90,7 +111,7 @@ func (lr *ListingRequest) getRequest(ctx context.Context) (*http.Request, error)
 	req, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodGet,
-		lr.conf.RedditApiEndpoint+"/r/"+lr.conf.Subreddit+"/"+lr.conf.SubredditSearchType,
+		lr.conf.RedditApiEndpoint+lr.source.Path(lr.conf.SubredditSearchType),
 		strings.NewReader(body),
 	)
 	if err != nil {
@@ -103,10 +124,14 @@ func (lr *ListingRequest) getRequest(ctx context.Context) (*http.Request, error)
 }
 
 func (lr ListingRequest) DoRequest() (lres ListingResponse, err error) {
-	res, err := lr.client.Do(lr.request)
+	start := time.Now()
+	res, err := http_retry.Do(lr.client, lr.request, http_retry.NewPolicy(lr.conf.HttpMaxAttempts), metrics.RetryObserver("listing"))
+	metrics.ListingRequestDuration.WithLabelValues(lr.source.String()).Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.ListingRequests.WithLabelValues(lr.source.String(), metrics.StatusError).Inc()
 		return lres, err
 	}
+	metrics.ListingRequests.WithLabelValues(lr.source.String(), metrics.Status(res.StatusCode, nil)).Inc()
 
 	defer res.Body.Close()
 	resBody, err := ioutil.ReadAll(res.Body)
@@ -122,6 +147,12 @@ func (lr ListingRequest) DoRequest() (lres ListingResponse, err error) {
 			res.StatusCode,
 			bodyStr,
 		)
+		switch res.StatusCode {
+		case http.StatusTooManyRequests:
+			err = fmt.Errorf("%w: %v", http_client.ErrRateLimited, err)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			err = fmt.Errorf("%w: %v", reddit_oauth2.ErrAuthFailed, err)
+		}
 	} else {
 		err = json.Unmarshal([]byte(bodyStr), &lres)
 		if err != nil {
@@ -135,11 +166,13 @@ func NewListingRequest(
 	ctx context.Context,
 	client *http.Client,
 	conf config.Config,
+	source listing_sources.Source,
 	before string,
 	after string,
 ) (lr ListingRequest, err error) {
 	lr.conf = conf
 	lr.client = client
+	lr.source = source
 	lr.before = before
 	lr.after = after
 	req, err := lr.getRequest(ctx)
@@ -0,0 +1,73 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/gazetteer"
+	"earthpullr/internal/title_parser"
+	"earthpullr/internal/user_settings"
+	"fmt"
+	"go.uber.org/zap"
+)
+
+// locationFilter rejects posts by the country, continent, regions and landmarks their title mentions
+type locationFilter struct {
+	include []string
+	exclude []string
+}
+
+func newLocationFilter(filters user_settings.Filters) (*locationFilter, error) {
+	include, err := canonicalLocations(filters.IncludeLocations)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := canonicalLocations(filters.ExcludeLocations)
+	if err != nil {
+		return nil, err
+	}
+	return &locationFilter{include: include, exclude: exclude}, nil
+}
+
+func canonicalLocations(names []string) ([]string, error) {
+	var canonical []string
+	for _, name := range names {
+		location, err := gazetteer.Canonical(name)
+		if err != nil {
+			return nil, err
+		}
+		canonical = append(canonical, location)
+	}
+	return canonical, nil
+}
+
+// titleLocation looks up the location parsed from a title, notes and resolutions aren't looked up so they can't be
+// mistaken for places. Nil is returned when no known place is mentioned.
+func titleLocation(metadata title_parser.TitleMetadata) *gazetteer.Location {
+	location := gazetteer.Lookup(metadata.Place + ", " + metadata.Country)
+	if location.IsEmpty() {
+		return nil
+	}
+	return &location
+}
+
+// rejectionReason returns rejectedLocationExcluded or rejectedLocationNotIncluded, or an empty string if the location
+// is allowed. Posts with an unrecognised location are only rejected when include locations are set.
+func (filter *locationFilter) rejectionReason(logger *zap.Logger, uid string, location *gazetteer.Location) string {
+	if location == nil {
+		location = &gazetteer.Location{}
+	}
+	for _, name := range filter.exclude {
+		if location.Matches(name) {
+			logger.Debug(fmt.Sprintf("Location of '%s' matches the excluded location '%s'", uid, name))
+			return rejectedLocationExcluded
+		}
+	}
+	if len(filter.include) == 0 {
+		return ""
+	}
+	for _, name := range filter.include {
+		if location.Matches(name) {
+			return ""
+		}
+	}
+	logger.Debug(fmt.Sprintf("Location of '%s' does not match any included location", uid))
+	return rejectedLocationNotIncluded
+}
@@ -0,0 +1,48 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/user_settings"
+	"earthpullr/pkg/image_format"
+	"fmt"
+	stdimage "image"
+	"os"
+	"path/filepath"
+)
+
+// downloadSuffix is used while an image is downloaded, before its format is known
+const downloadSuffix = ".download"
+
+// saveInOutputFormat moves a downloaded image to a file named by its post and format, converting it when the output
+// format differs from the format it was downloaded in. Images already in the output format are kept byte for byte so
+// JPEGs aren't recompressed, unless the output format is JPEG and a JPEG quality has been set. The file name it was
+// saved as is returned.
+func saveInOutputFormat(downloadPath string, uid string, img stdimage.Image, format string, outputFormat string, jpegQuality int) (string, error) {
+	recompress := outputFormat == user_settings.OutputFormatJPEG && format == image_format.JPEG && jpegQuality != 0
+	if outputFormat == "" || outputFormat == user_settings.OutputFormatOriginal {
+		outputFormat = format
+	}
+	ext, err := image_format.Extension(outputFormat)
+	if err != nil {
+		return "", err
+	}
+	fileName := uid + ext
+	fpath := filepath.Join(filepath.Dir(downloadPath), fileName)
+	if outputFormat == format && !recompress {
+		return fileName, os.Rename(downloadPath, fpath)
+	}
+
+	file, err := os.Create(fpath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file '%s', reason: %w", fpath, err)
+	}
+	err = image_format.Encode(file, img, outputFormat, jpegQuality)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fpath)
+		return "", fmt.Errorf("failed to encode image as %s: %w", outputFormat, err)
+	}
+	return fileName, os.Remove(downloadPath)
+}
@@ -0,0 +1,69 @@
+package reddit_cli
+
+import (
+	"bytes"
+	"earthpullr/internal/user_settings"
+	"earthpullr/pkg/image_format"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveInOutputFormat(t *testing.T) {
+	tests := []struct {
+		name         string
+		fname        string
+		outputFormat string
+		jpegQuality  int
+		wantFname    string
+		wantFormat   string
+		// wantUnchanged is whether the downloaded bytes are kept as they are
+		wantUnchanged bool
+	}{
+		{name: "original", fname: "Lake_0,_New_Zealand_[OC]_[480x270].jpg", outputFormat: user_settings.OutputFormatOriginal, jpegQuality: 10, wantFname: "t3_a.jpg", wantFormat: image_format.JPEG, wantUnchanged: true},
+		{name: "jpeg without a quality", fname: "Lake_0,_New_Zealand_[OC]_[480x270].jpg", outputFormat: user_settings.OutputFormatJPEG, wantFname: "t3_a.jpg", wantFormat: image_format.JPEG, wantUnchanged: true},
+		{name: "jpeg with a quality", fname: "Lake_0,_New_Zealand_[OC]_[480x270].jpg", outputFormat: user_settings.OutputFormatJPEG, jpegQuality: 10, wantFname: "t3_a.jpg", wantFormat: image_format.JPEG},
+		{name: "png to jpeg", fname: "Lake_1,_New_Zealand_[OC]_[496x279].png", outputFormat: user_settings.OutputFormatJPEG, wantFname: "t3_a.jpg", wantFormat: image_format.JPEG},
+		{name: "jpeg to png", fname: "Lake_0,_New_Zealand_[OC]_[480x270].jpg", outputFormat: user_settings.OutputFormatPNG, wantFname: "t3_a.png", wantFormat: image_format.PNG},
+	}
+	fixtureDir := t.TempDir()
+	writeFixtures(t, fixtureDir, 2)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			downloaded, err := ioutil.ReadFile(filepath.Join(fixtureDir, test.fname))
+			if err != nil {
+				t.Fatal(err)
+			}
+			downloadPath := filepath.Join(t.TempDir(), "t3_a"+downloadSuffix)
+			err = ioutil.WriteFile(downloadPath, downloaded, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, format, err := image_format.DecodeFile(downloadPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fname, err := saveInOutputFormat(downloadPath, "t3_a", img, format, test.outputFormat, test.jpegQuality)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fname != test.wantFname {
+				t.Fatalf("saved as '%s', want '%s'", fname, test.wantFname)
+			}
+			saved, err := ioutil.ReadFile(filepath.Join(filepath.Dir(downloadPath), fname))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unchanged := bytes.Equal(saved, downloaded); unchanged != test.wantUnchanged {
+				t.Fatalf("got the downloaded bytes unchanged %t, want %t", unchanged, test.wantUnchanged)
+			}
+			if sniffed := image_format.Sniff(saved); sniffed != test.wantFormat {
+				t.Fatalf("saved a %s, want a %s", sniffed, test.wantFormat)
+			}
+			if files, _ := ioutil.ReadDir(filepath.Dir(downloadPath)); len(files) != 1 {
+				t.Fatalf("expected only the saved image to be left, got %d files", len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/config"
+	"earthpullr/internal/reddit_oauth"
+	"earthpullr/pkg/desktop_notify"
+	"earthpullr/pkg/http_client"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// runNotifier shows a desktop notification when a run finishes or fails, each kind of event can be turned off in the
+// config. Failing to notify is logged and never fails the run.
+type runNotifier struct {
+	logger  *zap.Logger
+	conf    config.Config
+	connect func() (desktop_notify.Sender, error)
+	mu      sync.Mutex
+	sender  desktop_notify.Sender
+	// disabled is set once connecting fails so a desktop without a session bus only logs it once
+	disabled bool
+}
+
+func newRunNotifier(logger *zap.Logger, conf config.Config) *runNotifier {
+	return &runNotifier{
+		logger: logger,
+		conf:   conf,
+		connect: func() (desktop_notify.Sender, error) {
+			return desktop_notify.ConnectSessionBus(conf.ApplicationName)
+		},
+	}
+}
+
+// runFinished is passed the error the run failed with, if any. Errors saving a batch only fail the run when too few
+// backgrounds were found so the last one is checked too, as a full disk is worth knowing about even when enough were.
+func (notifier *runNotifier) runFinished(run *backgroundsRun, runErr error) {
+	if !notifier.conf.DesktopNotifications || run.request.DryRun {
+		return
+	}
+	notification, ok := notifier.failureNotification(runErr, run.batchErr)
+	if !ok && runErr == nil && notifier.conf.NotifyRunFinished {
+		notification, ok = notifier.finishedNotification(run), true
+	}
+	if ok {
+		notifier.notify(notification)
+	}
+}
+
+func (notifier *runNotifier) failureNotification(runErr error, batchErr error) (desktop_notify.Notification, bool) {
+	err := runErr
+	if err == nil {
+		err = batchErr
+	}
+	if err == nil {
+		return desktop_notify.Notification{}, false
+	}
+	notification := desktop_notify.Notification{
+		Body:     err.Error(),
+		Urgency:  desktop_notify.UrgencyCritical,
+		Category: desktop_notify.CategoryTransferError,
+	}
+	switch {
+	case isDiskFull(err):
+		notification.Summary = "Backgrounds could not be saved, the disk is full"
+		return notification, notifier.conf.NotifyDiskFull
+	case errors.Is(err, http_client.ErrRateLimited):
+		notification.Summary = "Reddit is rate limiting earthpullr, try again later"
+		notification.Urgency = desktop_notify.UrgencyNormal
+		return notification, notifier.conf.NotifyRateLimited
+	case errors.Is(err, reddit_oauth.ErrAuthFailed):
+		notification.Summary = "Reddit rejected earthpullr's credentials, try logging in again"
+		return notification, notifier.conf.NotifyAuthFailed
+	case runErr != nil:
+		notification.Summary = "Failed to retrieve backgrounds"
+		return notification, notifier.conf.NotifyOtherFailures
+	}
+	// Other batch errors are only logged, the run finished notification covers what was saved
+	return desktop_notify.Notification{}, false
+}
+
+func (notifier *runNotifier) finishedNotification(run *backgroundsRun) desktop_notify.Notification {
+	notification := desktop_notify.Notification{
+		Summary:  fmt.Sprintf("Saved %d of %d backgrounds", run.summary.SavedImages, run.request.BackgroundsCount),
+		Body:     run.request.DownloadPath,
+		Urgency:  desktop_notify.UrgencyLow,
+		Category: desktop_notify.CategoryTransferComplete,
+	}
+	if len(run.savedPaths) > 0 {
+		notification.ImagePath = run.savedPaths[len(run.savedPaths)-1]
+	}
+	return notification
+}
+
+// notify connects to the session bus the first time it's needed, and again after a failed notification in case the
+// bus was restarted
+func (notifier *runNotifier) notify(notification desktop_notify.Notification) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if notifier.disabled {
+		return
+	}
+	if notifier.sender == nil {
+		sender, err := notifier.connect()
+		if err != nil {
+			notifier.logger.Warn("Disabling desktop notifications", zap.Error(err))
+			notifier.disabled = true
+			return
+		}
+		notifier.sender = sender
+	}
+	err := notifier.sender.Notify(notification)
+	if err != nil {
+		notifier.logger.Warn("Failed to show desktop notification", zap.String("summary", notification.Summary), zap.Error(err))
+		notifier.sender.Close()
+		notifier.sender = nil
+	}
+}
@@ -0,0 +1,161 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/config"
+	"earthpullr/internal/reddit_oauth"
+	"earthpullr/pkg/desktop_notify"
+	"earthpullr/pkg/http_client"
+	"earthpullr/pkg/mock_reddit"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+type fakeSender struct {
+	mu            sync.Mutex
+	notifications []desktop_notify.Notification
+}
+
+func (sender *fakeSender) Notify(notification desktop_notify.Notification) error {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	sender.notifications = append(sender.notifications, notification)
+	return nil
+}
+
+func (sender *fakeSender) Close() error {
+	return nil
+}
+
+func (sender *fakeSender) sent() []desktop_notify.Notification {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	return append([]desktop_notify.Notification(nil), sender.notifications...)
+}
+
+func newTestNotifier(conf config.Config) (*runNotifier, *fakeSender) {
+	sender := &fakeSender{}
+	notifier := newRunNotifier(zap.NewNop(), conf)
+	notifier.connect = func() (desktop_notify.Sender, error) {
+		return sender, nil
+	}
+	return notifier, sender
+}
+
+func notificationsConfig(configure func(conf *config.Config)) config.Config {
+	conf := config.NewDefaultConfig()
+	conf.DesktopNotifications = true
+	if configure != nil {
+		configure(&conf)
+	}
+	return conf
+}
+
+func TestRunNotifications(t *testing.T) {
+	diskFull := fmt.Errorf("failed to save image batch: %w", &os.PathError{Op: "write", Path: "lake.jpg", Err: syscall.ENOSPC})
+	rateLimited := fmt.Errorf("failed to get Listings: %w status: got 429 Too Many Requests", http_client.ErrRateLimited)
+	authFailed := fmt.Errorf("failed to get an oauth token: %w", reddit_oauth.ErrAuthFailed)
+	otherBatchErr := errors.New("failed to save image batch: permission denied")
+	tests := []struct {
+		name      string
+		configure func(conf *config.Config)
+		saved     int
+		batchErr  error
+		runErr    error
+		dryRun    bool
+		// want is the summary of the notification sent, empty when none is
+		want        string
+		wantUrgency desktop_notify.Urgency
+	}{
+		{name: "finished", saved: 3, want: "Saved 3 of 3 backgrounds", wantUrgency: desktop_notify.UrgencyLow},
+		{name: "finished turned off", configure: func(conf *config.Config) { conf.NotifyRunFinished = false }, saved: 3},
+		{name: "notifications turned off", configure: func(conf *config.Config) { conf.DesktopNotifications = false }, saved: 3},
+		{name: "dry run", saved: 3, dryRun: true},
+		{name: "disk full", runErr: diskFull, batchErr: diskFull, want: "Backgrounds could not be saved, the disk is full", wantUrgency: desktop_notify.UrgencyCritical},
+		{name: "disk full with some saved", saved: 2, batchErr: diskFull, want: "Backgrounds could not be saved, the disk is full", wantUrgency: desktop_notify.UrgencyCritical},
+		{name: "disk full turned off", configure: func(conf *config.Config) { conf.NotifyDiskFull = false }, runErr: diskFull, batchErr: diskFull},
+		{name: "rate limited", runErr: rateLimited, want: "Reddit is rate limiting earthpullr, try again later", wantUrgency: desktop_notify.UrgencyNormal},
+		{name: "rate limited turned off", configure: func(conf *config.Config) { conf.NotifyRateLimited = false }, runErr: rateLimited},
+		{name: "auth failed", runErr: authFailed, want: "Reddit rejected earthpullr's credentials, try logging in again", wantUrgency: desktop_notify.UrgencyCritical},
+		{name: "auth failed turned off", configure: func(conf *config.Config) { conf.NotifyAuthFailed = false }, runErr: authFailed},
+		{name: "every batch failed", runErr: fmt.Errorf("found 0 of 3 backgrounds: %w", otherBatchErr), batchErr: otherBatchErr, want: "Failed to retrieve backgrounds", wantUrgency: desktop_notify.UrgencyCritical},
+		{name: "other failures turned off", configure: func(conf *config.Config) { conf.NotifyOtherFailures = false }, runErr: otherBatchErr, batchErr: otherBatchErr},
+		{name: "some batches failed", saved: 3, batchErr: otherBatchErr, want: "Saved 3 of 3 backgrounds", wantUrgency: desktop_notify.UrgencyLow},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notifier, sender := newTestNotifier(notificationsConfig(test.configure))
+			run := &backgroundsRun{
+				request:  BackgroundsRequest{BackgroundsCount: 3, DownloadPath: "/backgrounds", DryRun: test.dryRun},
+				summary:  &RunSummary{SavedImages: test.saved},
+				batchErr: test.batchErr,
+			}
+
+			notifier.runFinished(run, test.runErr)
+			sent := sender.sent()
+			if test.want == "" {
+				if len(sent) != 0 {
+					t.Fatalf("expected no notification, got %+v", sent)
+				}
+				return
+			}
+			if len(sent) != 1 {
+				t.Fatalf("sent %d notifications, want 1", len(sent))
+			}
+			if sent[0].Summary != test.want || sent[0].Urgency != test.wantUrgency {
+				t.Fatalf("got %+v, want summary '%s' with urgency %d", sent[0], test.want, test.wantUrgency)
+			}
+		})
+	}
+}
+
+func TestNotifierDisabledWithoutSessionBus(t *testing.T) {
+	notifier := newRunNotifier(zap.NewNop(), notificationsConfig(nil))
+	connects := 0
+	notifier.connect = func() (desktop_notify.Sender, error) {
+		connects++
+		return nil, errors.New("no session bus")
+	}
+	run := &backgroundsRun{summary: &RunSummary{SavedImages: 1}, request: BackgroundsRequest{BackgroundsCount: 1}}
+
+	notifier.runFinished(run, nil)
+	notifier.runFinished(run, nil)
+	if connects != 1 {
+		t.Fatalf("connected %d times, want once", connects)
+	}
+}
+
+func TestFetchBackgroundsNotifiesWhenEveryBatchFails(t *testing.T) {
+	retriever, server, downloadPath := newTestRetriever(t, mock_reddit.Faults{}, func(conf *config.Config) {
+		conf.DesktopNotifications = true
+	})
+	sender := &fakeSender{}
+	retriever.notifier.connect = func() (desktop_notify.Sender, error) {
+		return sender, nil
+	}
+	posts, err := server.Posts(retriever.conf.Subreddit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range posts {
+		err = os.Mkdir(filepath.Join(downloadPath, post.Name+downloadSuffix), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = retriever.FetchBackgrounds(testRequest(downloadPath, 3), nil)
+	if err == nil {
+		t.Fatal("expected failed batches to fail the run")
+	}
+	sent := sender.sent()
+	if len(sent) != 1 || sent[0].Summary != "Failed to retrieve backgrounds" {
+		t.Fatalf("expected a failure notification, got %+v", sent)
+	}
+}
@@ -0,0 +1,88 @@
+package reddit_cli
+
+import (
+	"earthpullr/internal/user_settings"
+	"fmt"
+	"go.uber.org/zap"
+	"regexp"
+	"strings"
+)
+
+// titleFilter rejects posts by their title, every keyword and pattern is matched case insensitively
+type titleFilter struct {
+	includeKeywords []string
+	excludeKeywords []string
+	includePatterns []*regexp.Regexp
+	excludePatterns []*regexp.Regexp
+}
+
+func newTitleFilter(filters user_settings.Filters) (*titleFilter, error) {
+	includePatterns, err := compileTitlePatterns(filters.TitleIncludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	excludePatterns, err := compileTitlePatterns(filters.TitleExcludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &titleFilter{
+		includeKeywords: lowerKeywords(filters.TitleIncludeKeywords),
+		excludeKeywords: lowerKeywords(filters.TitleExcludeKeywords),
+		includePatterns: includePatterns,
+		excludePatterns: excludePatterns,
+	}, nil
+}
+
+func compileTitlePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title pattern '%s': %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func lowerKeywords(keywords []string) []string {
+	var lowered []string
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" {
+			lowered = append(lowered, keyword)
+		}
+	}
+	return lowered
+}
+
+// rejectionReason returns rejectedTitleExcluded or rejectedTitleNotIncluded, or an empty string if the title is allowed
+func (filter *titleFilter) rejectionReason(logger *zap.Logger, title string) string {
+	if rule := filter.firstMatch(title, filter.excludeKeywords, filter.excludePatterns); rule != "" {
+		logger.Debug(fmt.Sprintf("Title '%s' matches the exclude rule '%s'", title, rule))
+		return rejectedTitleExcluded
+	}
+	if len(filter.includeKeywords) == 0 && len(filter.includePatterns) == 0 {
+		return ""
+	}
+	if filter.firstMatch(title, filter.includeKeywords, filter.includePatterns) == "" {
+		logger.Debug(fmt.Sprintf("Title '%s' does not match any include rule", title))
+		return rejectedTitleNotIncluded
+	}
+	return ""
+}
+
+func (filter *titleFilter) firstMatch(title string, keywords []string, patterns []*regexp.Regexp) string {
+	lowerTitle := strings.ToLower(title)
+	for _, keyword := range keywords {
+		if strings.Contains(lowerTitle, keyword) {
+			return keyword
+		}
+	}
+	for _, pattern := range patterns {
+		if pattern.MatchString(title) {
+			return pattern.String()
+		}
+	}
+	return ""
+}
@@ -3,16 +3,19 @@ package reddit_oauth
 import (
 	"context"
 	"earthpullr/internal/config"
-	"encoding/json"
+	"earthpullr/internal/metrics"
+	"earthpullr/pkg/http_retry"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 const oAuthTokenKey int = 0
 
+const applicationOnlyGrantLabel = "installed_client"
+
 type ApplicationOnlyOAuthRequest struct {
 	request           *http.Request
 	conf         	  config.Config
@@ -42,32 +45,24 @@ func (oAuthRequest *ApplicationOnlyOAuthRequest) getPostRequest(ctx context.Cont
 }
 
 func (oAuthRequest *ApplicationOnlyOAuthRequest) doRequest() (*http.Response, error) {
-	res, err := oAuthRequest.client.Do(oAuthRequest.request)
+	start := time.Now()
+	res, err := http_retry.Do(
+		oAuthRequest.client,
+		oAuthRequest.request,
+		http_retry.NewPolicy(oAuthRequest.conf.HttpMaxAttempts),
+		metrics.RetryObserver("oauth"),
+	)
+	metrics.OAuthTokenFetchDuration.WithLabelValues(applicationOnlyGrantLabel).Observe(time.Since(start).Seconds())
+	statusCode := 0
+	if res != nil {
+		statusCode = res.StatusCode
+	}
+	metrics.OAuthTokenFetches.WithLabelValues(applicationOnlyGrantLabel, metrics.Status(statusCode, err)).Inc()
 	return res, err
 }
 
 func (oAuthRequest *ApplicationOnlyOAuthRequest) extractResponse(response *http.Response) (oAuthToken OAuthToken, err error) {
-	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		err = fmt.Errorf("failed to read oauth request response body: %v", err)
-		return oAuthToken, err
-	}
-
-	bodyStr := string(body)
-	oAuthToken = OAuthToken{}
-	err = json.Unmarshal([]byte(bodyStr), &oAuthToken)
-	if err != nil {
-		err = fmt.Errorf("failed to parse oauth request response body json: %v", err)
-		return oAuthToken, err
-	}
-
-	if response.StatusCode == http.StatusTooManyRequests {
-		err = fmt.Errorf("rate limited status: got %v", response.Status)
-	} else if response.StatusCode != http.StatusOK {
-		err = fmt.Errorf("error status: got %v", response.Status)
-	}
-	return oAuthToken, err
+	return parseTokenResponse(response)
 }
 
 func (oAuthRequest ApplicationOnlyOAuthRequest) NewOAuthToken() (oAuthTokenPtr *OAuthToken, err error) {
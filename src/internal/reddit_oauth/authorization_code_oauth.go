@@ -0,0 +1,213 @@
+package reddit_oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"earthpullr/internal/config"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	authorizationCodeGrantLabel = "authorization_code"
+	refreshTokenGrantLabel      = "refresh_token"
+	loginTimeout                = 5 * time.Minute
+)
+
+// AuthorizationCodeFlow logs a reddit user in using the installed app authorization code flow with PKCE
+type AuthorizationCodeFlow struct {
+	conf        config.Config
+	client      *http.Client
+	store       TokenStore
+	scopes      []string
+	openBrowser func(authorizeURL string) error
+}
+
+func NewAuthorizationCodeFlow(client *http.Client, conf config.Config, store TokenStore, scopes []string, openBrowser func(authorizeURL string) error) *AuthorizationCodeFlow {
+	if len(scopes) == 0 {
+		scopes = conf.RedditOAuthScopes
+	}
+	return &AuthorizationCodeFlow{
+		conf:        conf,
+		client:      client,
+		store:       store,
+		scopes:      scopes,
+		openBrowser: openBrowser,
+	}
+}
+
+// Login opens the authorization page, waits for the loopback callback and stores the resulting refresh token
+func (flow *AuthorizationCodeFlow) Login(ctx context.Context) (*OAuthToken, StoredLogin, error) {
+	verifier, challenge, err := newPKCEPair()
+	if err != nil {
+		return nil, StoredLogin{}, err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return nil, StoredLogin{}, err
+	}
+	redirectURL, err := url.Parse(flow.conf.RedditRedirectUri)
+	if err != nil {
+		return nil, StoredLogin{}, fmt.Errorf("invalid redirect uri: %v", err)
+	}
+	callback, err := startCallbackServer(redirectURL, state)
+	if err != nil {
+		return nil, StoredLogin{}, err
+	}
+	defer callback.close()
+
+	err = flow.openBrowser(flow.authorizeURL(state, challenge))
+	if err != nil {
+		return nil, StoredLogin{}, fmt.Errorf("failed to open reddit authorization page: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+	code, err := callback.wait(ctx)
+	if err != nil {
+		return nil, StoredLogin{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", flow.conf.RedditRedirectUri)
+	form.Set("code_verifier", verifier)
+	token, err := requestToken(ctx, flow.client, flow.conf, form, authorizationCodeGrantLabel)
+	if err != nil {
+		return nil, StoredLogin{}, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	if token.RefreshToken == "" {
+		return nil, StoredLogin{}, fmt.Errorf("reddit did not return a refresh token")
+	}
+
+	login := StoredLogin{
+		RefreshToken: token.RefreshToken,
+		Scope:        token.Scope,
+	}
+	if hasScope(token.Scope, "identity") {
+		login.Username, err = fetchUsername(ctx, flow.client, flow.conf, token)
+		if err != nil {
+			return nil, StoredLogin{}, err
+		}
+	}
+	err = flow.store.Save(login)
+	if err != nil {
+		return nil, StoredLogin{}, fmt.Errorf("failed to store reddit login: %v", err)
+	}
+	return token, login, nil
+}
+
+func (flow *AuthorizationCodeFlow) authorizeURL(state string, challenge string) string {
+	query := url.Values{}
+	query.Set("client_id", flow.conf.RedditAppClientId)
+	query.Set("response_type", "code")
+	query.Set("state", state)
+	query.Set("redirect_uri", flow.conf.RedditRedirectUri)
+	query.Set("duration", "permanent")
+	query.Set("scope", strings.Join(flow.scopes, " "))
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	return flow.conf.RedditAuthorizeUrl + "?" + query.Encode()
+}
+
+// RefreshTokenRequest retrieves a user token from a stored login, usable anywhere an application only token is
+type RefreshTokenRequest struct {
+	ctx    context.Context
+	conf   config.Config
+	client *http.Client
+	store  TokenStore
+}
+
+func NewRefreshTokenRequest(ctx context.Context, client *http.Client, conf config.Config, store TokenStore) RefreshTokenRequest {
+	return RefreshTokenRequest{
+		ctx:    ctx,
+		conf:   conf,
+		client: client,
+		store:  store,
+	}
+}
+
+func (refreshRequest RefreshTokenRequest) NewOAuthToken() (*OAuthToken, error) {
+	login, err := refreshRequest.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", login.RefreshToken)
+	token, err := requestToken(refreshRequest.ctx, refreshRequest.client, refreshRequest.conf, form, refreshTokenGrantLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh reddit user token: %w", err)
+	}
+	if token.RefreshToken != "" && token.RefreshToken != login.RefreshToken {
+		login.RefreshToken = token.RefreshToken
+		err = refreshRequest.store.Save(login)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store rotated refresh token: %v", err)
+		}
+	}
+	return token, nil
+}
+
+func fetchUsername(ctx context.Context, client *http.Client, conf config.Config, token *OAuthToken) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, conf.RedditApiEndpoint+"/api/v1/me", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("User-Agent", conf.Platform+":"+conf.ApplicationName+":"+conf.Version)
+	req.Header.Add("Authorization", token.TokenType+" "+token.AccessToken)
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve reddit user: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read reddit user response: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to retrieve reddit user: got %v", res.Status)
+	}
+	var me struct {
+		Name string `json:"name"`
+	}
+	err = json.Unmarshal(body, &me)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse reddit user response: %v", err)
+	}
+	return me.Name, nil
+}
+
+func hasScope(scopes string, scope string) bool {
+	for _, s := range strings.FieldsFunc(scopes, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func newPKCEPair() (verifier string, challenge string, err error) {
+	verifier, err = randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func randomString(byteCount int) (string, error) {
+	b := make([]byte, byteCount)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,210 @@
+package reddit_oauth
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/pkg/mock_reddit"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type memoryTokenStore struct {
+	login *StoredLogin
+}
+
+func (store *memoryTokenStore) Load() (StoredLogin, error) {
+	if store.login == nil {
+		return StoredLogin{}, ErrNotLoggedIn
+	}
+	return *store.login, nil
+}
+
+func (store *memoryTokenStore) Save(login StoredLogin) error {
+	store.login = &login
+	return nil
+}
+
+func (store *memoryTokenStore) Delete() error {
+	store.login = nil
+	return nil
+}
+
+// newTestConfig points the config at a mock reddit, redirecting logins to a free loopback port
+func newTestConfig(t *testing.T) (config.Config, *mock_reddit.Server) {
+	t.Helper()
+	server := mock_reddit.NewServer(t.TempDir(), mock_reddit.Faults{})
+	err := server.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	conf := config.NewDefaultConfig()
+	conf.RedditAccessTokenUrl = server.AccessTokenURL()
+	conf.RedditAuthorizeUrl = server.AuthorizeURL()
+	conf.RedditApiEndpoint = server.URL()
+	conf.RedditRedirectUri = fmt.Sprintf("http://127.0.0.1:%d/authorize_callback", port)
+	conf.HttpMaxAttempts = 1
+	return conf, server
+}
+
+// visit stands in for the browser, following the authorization page back to the callback server
+func visit(authorizeURL string) error {
+	go func() {
+		res, err := http.Get(authorizeURL)
+		if err == nil {
+			res.Body.Close()
+		}
+	}()
+	return nil
+}
+
+// callbackWith skips the authorization page, calling back with the query built from the page's state
+func callbackWith(conf config.Config, query func(state string) url.Values) func(string) error {
+	return func(authorizeURL string) error {
+		parsed, err := url.Parse(authorizeURL)
+		if err != nil {
+			return err
+		}
+		return visit(conf.RedditRedirectUri + "?" + query(parsed.Query().Get("state")).Encode())
+	}
+}
+
+func TestLogin(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	store := &memoryTokenStore{}
+	flow := NewAuthorizationCodeFlow(http.DefaultClient, conf, store, []string{"identity", "read"}, visit)
+
+	token, login, err := flow.Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken == "" || login.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %+v", token)
+	}
+	if login.Username != mock_reddit.MockUsername {
+		t.Fatalf("got username '%s', want '%s'", login.Username, mock_reddit.MockUsername)
+	}
+	if store.login == nil || *store.login != login {
+		t.Fatalf("stored %+v, want %+v", store.login, login)
+	}
+}
+
+func TestLoginRequiresMatchingCodeVerifier(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	flow := NewAuthorizationCodeFlow(http.DefaultClient, conf, &memoryTokenStore{}, nil, func(authorizeURL string) error {
+		// The code is issued for a different challenge to the one the flow's verifier hashes to
+		parsed, err := url.Parse(authorizeURL)
+		if err != nil {
+			return err
+		}
+		query := parsed.Query()
+		query.Set("code_challenge", "forged")
+		parsed.RawQuery = query.Encode()
+		return visit(parsed.String())
+	})
+
+	_, _, err := flow.Login(context.Background())
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected the code exchange to be rejected, got %v", err)
+	}
+}
+
+func TestLoginRejectsStateMismatch(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	store := &memoryTokenStore{}
+	flow := NewAuthorizationCodeFlow(http.DefaultClient, conf, store, nil, callbackWith(conf, func(state string) url.Values {
+		return url.Values{"state": {state + "-forged"}, "code": {"mock-code-1"}}
+	}))
+
+	_, _, err := flow.Login(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "state did not match") {
+		t.Fatalf("expected a state mismatch, got %v", err)
+	}
+	if store.login != nil {
+		t.Fatal("stored a login after a state mismatch")
+	}
+}
+
+func TestLoginDeniedConsent(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	flow := NewAuthorizationCodeFlow(http.DefaultClient, conf, &memoryTokenStore{}, nil, callbackWith(conf, func(state string) url.Values {
+		return url.Values{"state": {state}, "error": {"access_denied"}}
+	}))
+
+	_, _, err := flow.Login(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Fatalf("expected the denied consent to fail the login, got %v", err)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	store := &memoryTokenStore{}
+	_, login, err := NewAuthorizationCodeFlow(http.DefaultClient, conf, store, nil, visit).Login(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := NewRefreshTokenRequest(context.Background(), http.DefaultClient, conf, store).NewOAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken == "" {
+		t.Fatal("expected an access token")
+	}
+	if store.login.RefreshToken != login.RefreshToken {
+		t.Fatalf("refresh token changed from '%s' to '%s'", login.RefreshToken, store.login.RefreshToken)
+	}
+}
+
+func TestRefreshRevokedToken(t *testing.T) {
+	conf, _ := newTestConfig(t)
+	store := &memoryTokenStore{login: &StoredLogin{RefreshToken: "revoked"}}
+
+	_, err := NewRefreshTokenRequest(context.Background(), http.DefaultClient, conf, store).NewOAuthToken()
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected a revoked refresh token to fail authentication, got %v", err)
+	}
+}
+
+func TestRefreshNotLoggedIn(t *testing.T) {
+	conf, _ := newTestConfig(t)
+
+	_, err := NewRefreshTokenRequest(context.Background(), http.DefaultClient, conf, &memoryTokenStore{}).NewOAuthToken()
+	if !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("expected not logged in, got %v", err)
+	}
+}
+
+func TestApplicationOnlyTokenAuthFailed(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message": "Unauthorized"}`, status)
+		}))
+		conf := config.NewDefaultConfig()
+		conf.RedditAccessTokenUrl = server.URL
+		request, err := NewApplicationOnlyOAuthRequest(context.Background(), server.Client(), conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = request.NewOAuthToken()
+		server.Close()
+		if !errors.Is(err, ErrAuthFailed) {
+			t.Fatalf("status %d: expected an auth failure, got %v", status, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package reddit_oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+const callbackPage = `<html><body><p>earthpullr %s, you can close this window.</p></body></html>`
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// callbackServer receives the authorization code once the user approves access in their browser
+type callbackServer struct {
+	server  *http.Server
+	results chan callbackResult
+}
+
+func startCallbackServer(redirectURL *url.URL, state string) (*callbackServer, error) {
+	switch redirectURL.Hostname() {
+	case "127.0.0.1", "localhost", "::1":
+	default:
+		return nil, fmt.Errorf("redirect uri '%s' must use a loopback address", redirectURL)
+	}
+	listener, err := net.Listen("tcp", redirectURL.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the oauth callback on '%s': %v", redirectURL.Host, err)
+	}
+	callback := &callbackServer{results: make(chan callbackResult, 1)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirectURL.Path, func(w http.ResponseWriter, r *http.Request) {
+		result := parseCallback(r.URL.Query(), state)
+		if result.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, callbackPage, "login failed")
+		} else {
+			fmt.Fprintf(w, callbackPage, "login succeeded")
+		}
+		select {
+		case callback.results <- result:
+		default:
+			// Only the first callback is used
+		}
+	})
+	callback.server = &http.Server{Handler: mux}
+	go callback.server.Serve(listener)
+	return callback, nil
+}
+
+func parseCallback(query url.Values, state string) callbackResult {
+	if query.Get("state") != state {
+		return callbackResult{err: fmt.Errorf("oauth callback state did not match, the request may have been forged")}
+	}
+	if errMsg := query.Get("error"); errMsg != "" {
+		return callbackResult{err: fmt.Errorf("reddit authorization failed: %s", errMsg)}
+	}
+	code := query.Get("code")
+	if code == "" {
+		return callbackResult{err: errors.New("oauth callback did not include an authorization code")}
+	}
+	return callbackResult{code: code}
+}
+
+func (callback *callbackServer) wait(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("timed out waiting for reddit authorization: %w", ctx.Err())
+	case result := <-callback.results:
+		return result.code, result.err
+	}
+}
+
+func (callback *callbackServer) close() error {
+	return callback.server.Close()
+}
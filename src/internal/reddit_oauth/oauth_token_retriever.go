@@ -1,17 +1,15 @@
 package reddit_oauth
 
-import "context"
-
+// OAuthTokenRetriever is implemented by every grant, the tokens they return are interchangeable once in a context
 type OAuthTokenRetriever interface {
-	NewOAuthToken() *OAuthToken
-	FromContext(ctx context.Context) (*OAuthToken, error)
-	ToContext(ctx context.Context, token OAuthToken) context.Context
+	NewOAuthToken() (*OAuthToken, error)
 }
 
 type OAuthToken struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	DeviceID    string `json:"device_id"`
-	ExpiresIn   int    `json:"expires_in"`
-	Scope       string `json:"scope"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	DeviceID     string `json:"device_id"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
+	RefreshToken string `json:"refresh_token"`
 }
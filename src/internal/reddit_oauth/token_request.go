@@ -0,0 +1,87 @@
+package reddit_oauth
+
+import (
+	"context"
+	"earthpullr/internal/config"
+	"earthpullr/internal/metrics"
+	"earthpullr/pkg/http_client"
+	"earthpullr/pkg/http_retry"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrAuthFailed is wrapped when reddit rejects the app's credentials or a user's login, e.g. after it was revoked
+var ErrAuthFailed = errors.New("reddit rejected the credentials")
+
+type tokenErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// requestToken posts the form to the access token endpoint authenticating as the installed app
+func requestToken(ctx context.Context, client *http.Client, conf config.Config, form url.Values, grantLabel string) (*OAuthToken, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		conf.RedditAccessTokenUrl,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s token request: %v", grantLabel, err)
+	}
+	req.Header.Add("Content-Type", conf.RedditContentTypeHeader)
+	req.Header.Add("User-Agent", conf.Platform+":"+conf.ApplicationName+":"+conf.Version)
+	req.SetBasicAuth(conf.RedditAppClientId, "")
+
+	start := time.Now()
+	res, err := http_retry.Do(client, req, http_retry.NewPolicy(conf.HttpMaxAttempts), metrics.RetryObserver("oauth"))
+	metrics.OAuthTokenFetchDuration.WithLabelValues(grantLabel).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.OAuthTokenFetches.WithLabelValues(grantLabel, metrics.StatusError).Inc()
+		return nil, err
+	}
+	metrics.OAuthTokenFetches.WithLabelValues(grantLabel, metrics.Status(res.StatusCode, nil)).Inc()
+	oAuthToken, err := parseTokenResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	return &oAuthToken, nil
+}
+
+func parseTokenResponse(response *http.Response) (oAuthToken OAuthToken, err error) {
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read oauth request response body: %v", err)
+		return oAuthToken, err
+	}
+
+	// Error responses may not be JSON so the status is checked first
+	if response.StatusCode == http.StatusTooManyRequests {
+		return oAuthToken, fmt.Errorf("%w status: got %v", http_client.ErrRateLimited, response.Status)
+	} else if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		return oAuthToken, fmt.Errorf("%w: got %v", ErrAuthFailed, response.Status)
+	} else if response.StatusCode != http.StatusOK {
+		return oAuthToken, fmt.Errorf("error status: got %v", response.Status)
+	}
+
+	err = json.Unmarshal(body, &oAuthToken)
+	if err != nil {
+		err = fmt.Errorf("failed to parse oauth request response body json: %v", err)
+		return oAuthToken, err
+	}
+	// reddit reports grant errors such as invalid_grant with a 200 status
+	var errorResponse tokenErrorResponse
+	if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error != "" {
+		return oAuthToken, fmt.Errorf("%w, oauth token request failed: %s", ErrAuthFailed, errorResponse.Error)
+	}
+	if oAuthToken.AccessToken == "" {
+		return oAuthToken, fmt.Errorf("oauth token response did not include an access token")
+	}
+	return oAuthToken, nil
+}
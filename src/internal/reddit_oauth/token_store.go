@@ -0,0 +1,77 @@
+package reddit_oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// StoredLogin is what is persisted after a user logs in, the access token itself is never stored
+type StoredLogin struct {
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	Username     string `json:"username"`
+}
+
+type TokenStore interface {
+	// Load returns ErrNotLoggedIn when no login has been stored
+	Load() (StoredLogin, error)
+	Save(login StoredLogin) error
+	Delete() error
+}
+
+var ErrNotLoggedIn = errors.New("no reddit user is logged in")
+
+type FileTokenStore struct {
+	fpath string
+}
+
+// NewFileTokenStore stores the login within the user config directory, readable only by the current user
+func NewFileTokenStore(applicationName string, tokenFname string) (*FileTokenStore, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return &FileTokenStore{fpath: filepath.Join(configDir, applicationName, tokenFname)}, nil
+}
+
+func (store *FileTokenStore) Load() (StoredLogin, error) {
+	var login StoredLogin
+	byteValue, err := ioutil.ReadFile(store.fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return login, ErrNotLoggedIn
+	} else if err != nil {
+		return login, fmt.Errorf("failed to read stored login: %v", err)
+	}
+	err = json.Unmarshal(byteValue, &login)
+	if err != nil {
+		return login, fmt.Errorf("failed to unmarshall stored login: %v", err)
+	}
+	if login.RefreshToken == "" {
+		return login, ErrNotLoggedIn
+	}
+	return login, nil
+}
+
+func (store *FileTokenStore) Save(login StoredLogin) error {
+	out, err := json.Marshal(login)
+	if err != nil {
+		return fmt.Errorf("failed to marshall login: %v", err)
+	}
+	err = os.MkdirAll(filepath.Dir(store.fpath), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create login directory: %v", err)
+	}
+	return ioutil.WriteFile(store.fpath, out, 0600)
+}
+
+func (store *FileTokenStore) Delete() error {
+	err := os.Remove(store.fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
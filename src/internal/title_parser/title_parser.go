@@ -0,0 +1,125 @@
+// Package title_parser extracts structured metadata from EarthPorn style titles such as
+// "Lake Tekapo, New Zealand [OC] [4032x3024]".
+package title_parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type TitleMetadata struct {
+	Place   string `json:"place,omitempty"`
+	Country string `json:"country,omitempty"`
+	OC      bool   `json:"oc"`
+	// DeclaredWidth and DeclaredHeight are zero when the title does not state a resolution
+	DeclaredWidth  int `json:"declared_width,omitempty"`
+	DeclaredHeight int `json:"declared_height,omitempty"`
+}
+
+func (metadata TitleMetadata) HasDeclaredResolution() bool {
+	return metadata.DeclaredWidth > 0 && metadata.DeclaredHeight > 0
+}
+
+var (
+	// e.g. 4032x3024, 4032 X 3024, 4032×3024, 4,032 x 3,024 and 4032*3024px
+	resolutionPattern = regexp.MustCompile(`\b(\d{1,2},\d{3}|\d{3,5})\s*(?:[xX×*]|by)\s*(\d{1,2},\d{3}|\d{3,5})(?:\s*px\b|\b)`)
+	ocPattern         = regexp.MustCompile(`(?i)(^|[^\pL\pN])\[?\(?O\.?C\.?\)?\]?([^\pL\pN]|$)`)
+	bracketedPattern  = regexp.MustCompile(`[\[({][^\])}]*[\])}]`)
+	// Notes such as "Sunrise over the lake - Lake Tekapo, New Zealand" or "Lake Tekapo, New Zealand. Taken at dawn"
+	noteSeparatorPattern = regexp.MustCompile(`\s+[-–—|~]\s+|:\s+|;\s*`)
+	sentenceEndPattern   = regexp.MustCompile(`\.\s+`)
+	// Abbreviations within place names such as "Mt. Cook" and "St. Mary Lake" are a capital and up to two letters
+	abbreviationPattern = regexp.MustCompile(`^\p{Lu}\p{Ll}{0,2}$`)
+	spacesPattern       = regexp.MustCompile(`\s+`)
+)
+
+// longAbbreviations are abbreviations within place names which abbreviationPattern doesn't match
+var longAbbreviations = map[string]bool{
+	"mtn":  true,
+	"mtns": true,
+	"natl": true,
+}
+
+const maxDeclaredResolution = 100000
+
+// Parse never fails, any part of the title that can't be recognised is left as its zero value
+func Parse(title string) TitleMetadata {
+	var metadata TitleMetadata
+	title = strings.TrimSpace(title)
+
+	if matches := resolutionPattern.FindAllStringSubmatch(title, -1); len(matches) > 0 {
+		// The resolution is conventionally last, earlier matches may be part of the place e.g. an altitude
+		match := matches[len(matches)-1]
+		width, widthErr := parseDimension(match[1])
+		height, heightErr := parseDimension(match[2])
+		if widthErr == nil && heightErr == nil && width < maxDeclaredResolution && height < maxDeclaredResolution {
+			metadata.DeclaredWidth = width
+			metadata.DeclaredHeight = height
+		}
+	}
+	metadata.OC = ocPattern.MatchString(title)
+
+	location := resolutionPattern.ReplaceAllString(title, " ")
+	location = bracketedPattern.ReplaceAllString(location, " ")
+	location = ocPattern.ReplaceAllString(location, "$1 $2")
+	location = chooseLocationSegment(splitNotes(location))
+	location = cleanPart(location)
+
+	if comma := strings.LastIndex(location, ","); comma >= 0 {
+		metadata.Place = cleanPart(location[:comma])
+		metadata.Country = cleanPart(location[comma+1:])
+	} else {
+		metadata.Place = location
+	}
+	return metadata
+}
+
+func parseDimension(raw string) (int, error) {
+	return strconv.Atoi(strings.ReplaceAll(raw, ",", ""))
+}
+
+// splitNotes splits the title into the location and any notes, a full stop only ends a note when it doesn't end an
+// abbreviation
+func splitNotes(title string) []string {
+	var segments []string
+	for _, part := range noteSeparatorPattern.Split(title, -1) {
+		start := 0
+		for _, end := range sentenceEndPattern.FindAllStringIndex(part, -1) {
+			words := strings.Fields(part[start:end[0]])
+			if len(words) > 0 && isAbbreviation(words[len(words)-1]) {
+				continue
+			}
+			segments = append(segments, part[start:end[0]])
+			start = end[1]
+		}
+		segments = append(segments, part[start:])
+	}
+	return segments
+}
+
+func isAbbreviation(word string) bool {
+	return abbreviationPattern.MatchString(word) || longAbbreviations[strings.ToLower(word)]
+}
+
+// chooseLocationSegment prefers the segment of the title written as "Place, Country", falling back to the first
+func chooseLocationSegment(segments []string) string {
+	var first string
+	for _, segment := range segments {
+		if strings.TrimSpace(segment) == "" {
+			continue
+		}
+		if strings.Contains(segment, ",") {
+			return segment
+		}
+		if first == "" {
+			first = segment
+		}
+	}
+	return first
+}
+
+func cleanPart(part string) string {
+	part = spacesPattern.ReplaceAllString(part, " ")
+	return strings.Trim(part, " ,.-–—|~:;!?\"'[](){}")
+}
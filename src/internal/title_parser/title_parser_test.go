@@ -0,0 +1,124 @@
+package title_parser
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		title string
+		want  TitleMetadata
+	}{
+		{
+			"Lake Tekapo, New Zealand [OC] [4032x3024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand (OC) (4032x3024)",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand {OC} {4032x3024}",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand [OC][4032 X 3024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand [4032×3024] [OC]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand [OC] [4,032 x 3,024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand [OC] [4032*3024px]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand OC 4032x3024px",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand [O.C.] [6000 by 4000]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 6000, DeclaredHeight: 4000},
+		},
+		{
+			"Lake Tekapo, New Zealand [4032x3024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand"},
+		},
+		{
+			"Sunrise over the lake",
+			TitleMetadata{Place: "Sunrise over the lake"},
+		},
+		{
+			"Sunrise over the lake - Lake Tekapo, New Zealand [OC] [4032x3024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand. Taken at dawn [OC] [4032x3024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand: a cold morning [OC] [4032x3024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true, DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Lake Tekapo, New Zealand | shot on film [4032x3024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", DeclaredWidth: 4032, DeclaredHeight: 3024},
+		},
+		{
+			"Big Sur, CA. Fog rolling in [OC] [4000x3000]",
+			TitleMetadata{Place: "Big Sur", Country: "CA", OC: true, DeclaredWidth: 4000, DeclaredHeight: 3000},
+		},
+		{
+			"Mt. Cook, New Zealand [OC] [4000x3000]",
+			TitleMetadata{Place: "Mt. Cook", Country: "New Zealand", OC: true, DeclaredWidth: 4000, DeclaredHeight: 3000},
+		},
+		{
+			"St. Mary Lake, Glacier National Park, Montana",
+			TitleMetadata{Place: "St. Mary Lake, Glacier National Park", Country: "Montana"},
+		},
+		{
+			"Ft. Bragg coast, California. Low tide [3000x2000]",
+			TitleMetadata{Place: "Ft. Bragg coast", Country: "California", DeclaredWidth: 3000, DeclaredHeight: 2000},
+		},
+		{
+			"Pt. Reyes National Seashore, CA [OC] [3000x2000]",
+			TitleMetadata{Place: "Pt. Reyes National Seashore", Country: "CA", OC: true, DeclaredWidth: 3000, DeclaredHeight: 2000},
+		},
+		{
+			"Rocky Mtn. Natl. Park, Colorado [OC] [5000x3333]",
+			TitleMetadata{Place: "Rocky Mtn. Natl. Park", Country: "Colorado", OC: true, DeclaredWidth: 5000, DeclaredHeight: 3333},
+		},
+		{
+			"Summit at 4,200 m, Mt. Rainier, Washington [OC] [4000x3000]",
+			TitleMetadata{Place: "Summit at 4,200 m, Mt. Rainier", Country: "Washington", OC: true, DeclaredWidth: 4000, DeclaredHeight: 3000},
+		},
+		{
+			"Lake Tekapo, New Zealand [OC] [123456x3024]",
+			TitleMetadata{Place: "Lake Tekapo", Country: "New Zealand", OC: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got := Parse(test.title)
+			if got != test.want {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHasDeclaredResolution(t *testing.T) {
+	if !Parse("Lake Tekapo [4032x3024]").HasDeclaredResolution() {
+		t.Fatal("expected a declared resolution")
+	}
+	if Parse("Lake Tekapo").HasDeclaredResolution() {
+		t.Fatal("expected no declared resolution")
+	}
+}
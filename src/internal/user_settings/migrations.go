@@ -0,0 +1,61 @@
+package user_settings
+
+import (
+	"fmt"
+	"math"
+)
+
+// currentSchemaVersion must be bumped together with a new entry in migrations
+const currentSchemaVersion = 2
+
+// Settings files written before versioning was introduced have no schema_version and are treated as version 1
+const legacySchemaVersion = 1
+
+// migrations[i] upgrades raw settings from schema version i+1 to i+2
+var migrations = []func(rawSettings map[string]interface{}) error{
+	migrateV1ToV2,
+}
+
+func migrateUserSettings(rawSettings map[string]interface{}) (migrated bool, err error) {
+	version := legacySchemaVersion
+	if rawVersion, ok := rawSettings["schema_version"]; ok {
+		floatVersion, ok := rawVersion.(float64)
+		if !ok {
+			return false, fmt.Errorf("user settings schema_version must be a number, got %v", rawVersion)
+		}
+		if floatVersion < legacySchemaVersion || floatVersion != math.Trunc(floatVersion) {
+			return false, fmt.Errorf("user settings schema_version must be a whole number of at least %d, got %v", legacySchemaVersion, rawVersion)
+		}
+		version = int(floatVersion)
+	}
+	if version > currentSchemaVersion {
+		return false, fmt.Errorf("user settings schema version %d is newer than the supported version %d", version, currentSchemaVersion)
+	}
+	for ; version < currentSchemaVersion; version++ {
+		err = migrations[version-1](rawSettings)
+		if err != nil {
+			return false, fmt.Errorf("failed to migrate user settings from version %d: %w", version, err)
+		}
+		rawSettings["schema_version"] = version + 1
+		migrated = true
+	}
+	return migrated, nil
+}
+
+// migrateV1ToV2 adds the last used request fields, only download_path was persisted in version 1
+func migrateV1ToV2(rawSettings map[string]interface{}) error {
+	defaults := map[string]interface{}{
+		"download_path":     "",
+		"width":             0,
+		"height":            0,
+		"backgrounds_count": 0,
+		"sources":           []string{},
+		"filters":           map[string]interface{}{},
+	}
+	for key, value := range defaults {
+		if _, ok := rawSettings[key]; !ok {
+			rawSettings[key] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package user_settings
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUserSettingsMigrations(t *testing.T) {
+	tests := []struct {
+		name         string
+		json         string
+		wantMigrated bool
+		// wantErr is part of the error expected, empty when parsing should succeed
+		wantErr string
+	}{
+		{name: "version 1", json: `{"schema_version": 1, "download_path": "/backgrounds"}`, wantMigrated: true},
+		{name: "missing version", json: `{"download_path": "/backgrounds"}`, wantMigrated: true},
+		{name: "current version", json: `{"schema_version": 2, "download_path": "/backgrounds", "width": 1920, "sources": []}`},
+		{name: "zero version", json: `{"schema_version": 0}`, wantErr: "whole number of at least 1"},
+		{name: "negative version", json: `{"schema_version": -3}`, wantErr: "whole number of at least 1"},
+		{name: "fractional version", json: `{"schema_version": 1.5}`, wantErr: "whole number of at least 1"},
+		{name: "string version", json: `{"schema_version": "2"}`, wantErr: "must be a number"},
+		{name: "future version", json: `{"schema_version": 99}`, wantErr: "newer than the supported version"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings, migrated, err := parseUserSettings([]byte(test.json))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected an error containing '%s', got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if migrated != test.wantMigrated {
+				t.Fatalf("got migrated %t, want %t", migrated, test.wantMigrated)
+			}
+			if settings.SchemaVersion != currentSchemaVersion {
+				t.Fatalf("got schema version %d, want %d", settings.SchemaVersion, currentSchemaVersion)
+			}
+			if settings.DownloadPath != "/backgrounds" {
+				t.Fatalf("got download path '%s', want it kept through the migration", settings.DownloadPath)
+			}
+			if settings.Sources == nil {
+				t.Fatal("expected the migration to default sources to an empty list")
+			}
+		})
+	}
+}
@@ -1,86 +1,336 @@
 package user_settings
 
 import (
+	"earthpullr/internal/gazetteer"
+	"earthpullr/internal/listing_sources"
+	"earthpullr/pkg/image_colour"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 )
 
-type userSettings struct {
-	DownloadPath       string `json:"download_path"`
+const maxResolution = 7680 // 8K
+const maxBackgroundsCount = 50
+
+type Filters struct {
+	AspectRatioTolerance float64 `json:"aspect_ratio_tolerance" mapstructure:"aspect_ratio_tolerance"`
+	// Titles are matched case insensitively, when any include rule is set a title must match at least one of them
+	TitleIncludeKeywords []string `json:"title_include_keywords" mapstructure:"title_include_keywords"`
+	TitleExcludeKeywords []string `json:"title_exclude_keywords" mapstructure:"title_exclude_keywords"`
+	TitleIncludePatterns []string `json:"title_include_patterns" mapstructure:"title_include_patterns"`
+	TitleExcludePatterns []string `json:"title_exclude_patterns" mapstructure:"title_exclude_patterns"`
+	// Brightness is one of BrightnessDark, BrightnessLight or BrightnessSystem to follow the OS theme, empty allows any
+	Brightness   string  `json:"brightness" mapstructure:"brightness"`
+	MinLuminance float64 `json:"min_luminance" mapstructure:"min_luminance"`
+	// MaxLuminance of zero is unset
+	MaxLuminance float64  `json:"max_luminance" mapstructure:"max_luminance"`
+	DominantHues []string `json:"dominant_hues" mapstructure:"dominant_hues"`
+	// Locations are countries, continents, regions or landmarks known to the gazetteer e.g. "New Zealand" or "Patagonia",
+	// when any include location is set a post's title must mention one of them
+	IncludeLocations []string `json:"include_locations" mapstructure:"include_locations"`
+	ExcludeLocations []string `json:"exclude_locations" mapstructure:"exclude_locations"`
+}
+
+const (
+	BrightnessDark   = "dark"
+	BrightnessLight  = "light"
+	BrightnessSystem = "system"
+)
+
+type UserSettings struct {
+	SchemaVersion    int      `json:"schema_version" mapstructure:"schema_version"`
+	DownloadPath     string   `json:"download_path" mapstructure:"download_path"`
+	Width            int      `json:"width" mapstructure:"width"`
+	Height           int      `json:"height" mapstructure:"height"`
+	BackgroundsCount int      `json:"backgrounds_count" mapstructure:"backgrounds_count"`
+	Sources          []string `json:"sources" mapstructure:"sources"`
+	Filters          Filters  `json:"filters" mapstructure:"filters"`
+	// OutputFormat is one of the OutputFormat constants, empty keeps the original format
+	OutputFormat string `json:"output_format" mapstructure:"output_format"`
+	// JPEGQuality is between 1 and 100. Zero uses the default for converted images and keeps JPEGs as they are, otherwise
+	// JPEGs are recompressed at it too when the output format is jpeg.
+	JPEGQuality int `json:"jpeg_quality" mapstructure:"jpeg_quality"`
 }
 
+const (
+	OutputFormatOriginal = "original"
+	OutputFormatJPEG     = "jpeg"
+	OutputFormatPNG      = "png"
+)
+
 type UserSettingsManager struct {
-	fpath string
-	Settings userSettings
+	fpath    string
+	Settings UserSettings
 }
 
-func NewUserSettingsManager(userSettingsFname string) (UserSettingsManager, error) {
-	fpath, err := getUserSettingsFpath(userSettingsFname)
+func NewUserSettingsManager(applicationName string, userSettingsFname string) (UserSettingsManager, error) {
+	fpath, err := getUserSettingsFpath(applicationName, userSettingsFname)
 	if err != nil {
 		return UserSettingsManager{}, fmt.Errorf("failed to get user settings file path: %w", err)
 	}
+	manager := UserSettingsManager{
+		fpath:    fpath,
+		Settings: newDefaultUserSettings(),
+	}
 
-	// No user settings have been saved, just return an empty one
+	readFpath := fpath
 	if _, err := os.Stat(fpath); errors.Is(err, os.ErrNotExist) {
-		return UserSettingsManager{
-			fpath: fpath,
-			Settings: userSettings{
-				DownloadPath: "",
-			},
-		}, nil
+		// Settings written by older versions live next to the executable
+		readFpath = getLegacyUserSettingsFpath(userSettingsFname)
+		if readFpath == "" {
+			return manager, nil
+		}
+		if _, err := os.Stat(readFpath); errors.Is(err, os.ErrNotExist) {
+			// No user settings have been saved, just return the defaults
+			return manager, nil
+		}
 	}
 
-	settings, err := getUserSettingsFromFile(fpath)
+	settings, migrated, err := getUserSettingsFromFile(readFpath)
 	if err != nil {
 		return UserSettingsManager{}, fmt.Errorf("failed to read user settings file: %w", err)
 	}
-	return UserSettingsManager{
-		fpath: fpath,
-		Settings: settings,
-	}, nil
+	manager.Settings = settings
+	if migrated || readFpath != fpath {
+		err = manager.saveUserSettings()
+		if err != nil {
+			return UserSettingsManager{}, fmt.Errorf("failed to save migrated user settings: %w", err)
+		}
+	}
+	return manager, nil
 }
 
-func getUserSettingsFpath(userSettingsFname string) (string, error) {
-	ex, err := os.Executable()
+func newDefaultUserSettings() UserSettings {
+	return UserSettings{
+		SchemaVersion: currentSchemaVersion,
+		Sources:       []string{},
+	}
+}
+
+func getUserSettingsFpath(applicationName string, userSettingsFname string) (string, error) {
+	configDir, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
 	}
-	exPath := filepath.Dir(ex)
-	return filepath.Join(exPath, userSettingsFname), nil
+	return filepath.Join(configDir, applicationName, userSettingsFname), nil
+}
+
+func getLegacyUserSettingsFpath(userSettingsFname string) string {
+	ex, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(ex), userSettingsFname)
 }
 
-func getUserSettingsFromFile(fpath string) (userSettings, error) {
+func getUserSettingsFromFile(fpath string) (settings UserSettings, migrated bool, err error) {
 	file, err := os.Open(fpath)
 	if err != nil {
-		return userSettings{}, err
+		return settings, false, err
 	}
 	defer file.Close()
 	byteValue, err := ioutil.ReadAll(file)
 	if err != nil {
-		return userSettings{}, err
+		return settings, false, err
+	}
+	return parseUserSettings(byteValue)
+}
+
+// ParseUserSettings reads settings written by any version, such as those of an exported library
+func ParseUserSettings(byteValue []byte) (UserSettings, error) {
+	settings, _, err := parseUserSettings(byteValue)
+	return settings, err
+}
+
+func parseUserSettings(byteValue []byte) (settings UserSettings, migrated bool, err error) {
+	var rawSettings map[string]interface{}
+	err = json.Unmarshal(byteValue, &rawSettings)
+	if err != nil {
+		return settings, false, fmt.Errorf("failed to unmarshall user settings json file: %v", err)
+	}
+	migrated, err = migrateUserSettings(rawSettings)
+	if err != nil {
+		return settings, false, err
+	}
+	byteValue, err = json.Marshal(rawSettings)
+	if err != nil {
+		return settings, false, fmt.Errorf("failed to marshall migrated user settings: %v", err)
 	}
-	var settings userSettings
 	err = json.Unmarshal(byteValue, &settings)
 	if err != nil {
-		return userSettings{}, fmt.Errorf("failed to unmarshall user settings json file: %v", err)
+		return settings, false, fmt.Errorf("failed to unmarshall migrated user settings: %v", err)
 	}
-	return settings, nil
+	return settings, migrated, nil
 }
 
-func (us *UserSettingsManager) SaveNewUserSettings(downloadPath string) error {
-	us.Settings.DownloadPath = downloadPath
+// Validate checks every field of the settings, a zero value for any of the numeric fields means it is unset
+func (settings UserSettings) Validate() error {
+	if settings.DownloadPath != "" {
+		if _, err := os.Stat(settings.DownloadPath); os.IsNotExist(err) {
+			return fmt.Errorf("download path '%s' does not exist", settings.DownloadPath)
+		}
+	}
+	if settings.Width < 0 || settings.Width > maxResolution || settings.Height < 0 || settings.Height > maxResolution {
+		return fmt.Errorf("resolution must be between (0, 0) and (%d, %d) where zero is unset, got (%d, %d)", maxResolution, maxResolution, settings.Width, settings.Height)
+	}
+	if settings.BackgroundsCount < 0 || settings.BackgroundsCount > maxBackgroundsCount {
+		return fmt.Errorf("backgrounds count must be between 0 and %d where zero is unset, got %d", maxBackgroundsCount, settings.BackgroundsCount)
+	}
+	for _, source := range settings.Sources {
+		if _, err := listing_sources.Parse(source); err != nil {
+			return err
+		}
+	}
+	if settings.Filters.AspectRatioTolerance < 0 || settings.Filters.AspectRatioTolerance > 1 {
+		return fmt.Errorf("aspect ratio tolerance must be between 0 and 1, got %f", settings.Filters.AspectRatioTolerance)
+	}
+	err := ValidateOutputFormat(settings.OutputFormat, settings.JPEGQuality)
+	if err != nil {
+		return err
+	}
+	err = settings.Filters.ValidateTitlePatterns()
+	if err != nil {
+		return err
+	}
+	err = settings.Filters.ValidateLocations()
+	if err != nil {
+		return err
+	}
+	return settings.Filters.ValidateColourFilters()
+}
+
+func ValidateOutputFormat(outputFormat string, jpegQuality int) error {
+	switch outputFormat {
+	case "", OutputFormatOriginal, OutputFormatJPEG, OutputFormatPNG:
+	default:
+		return fmt.Errorf("output format must be one of '%s', '%s' or '%s', got '%s'", OutputFormatOriginal, OutputFormatJPEG, OutputFormatPNG, outputFormat)
+	}
+	if jpegQuality < 0 || jpegQuality > 100 {
+		return fmt.Errorf("JPEG quality must be between 1 and 100, got %d", jpegQuality)
+	}
+	return nil
+}
+
+func (filters Filters) ValidateLocations() error {
+	for _, location := range append(append([]string{}, filters.IncludeLocations...), filters.ExcludeLocations...) {
+		if _, err := gazetteer.Canonical(location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (filters Filters) ValidateColourFilters() error {
+	switch filters.Brightness {
+	case "", BrightnessDark, BrightnessLight, BrightnessSystem:
+	default:
+		return fmt.Errorf("brightness must be one of '%s', '%s' or '%s', got '%s'", BrightnessDark, BrightnessLight, BrightnessSystem, filters.Brightness)
+	}
+	if filters.MinLuminance < 0 || filters.MinLuminance > 1 || filters.MaxLuminance < 0 || filters.MaxLuminance > 1 {
+		return fmt.Errorf("luminance must be between 0 and 1, got a minimum of %f and maximum of %f", filters.MinLuminance, filters.MaxLuminance)
+	}
+	if filters.MaxLuminance != 0 && filters.MinLuminance > filters.MaxLuminance {
+		return fmt.Errorf("minimum luminance %f is greater than the maximum %f", filters.MinLuminance, filters.MaxLuminance)
+	}
+	for _, hue := range filters.DominantHues {
+		if !image_colour.IsHue(hue) {
+			return fmt.Errorf("unknown dominant hue '%s', must be one of %s", hue, strings.Join(image_colour.Hues, ", "))
+		}
+	}
+	return nil
+}
+
+func (filters Filters) ValidateTitlePatterns() error {
+	for _, pattern := range append(append([]string{}, filters.TitleIncludePatterns...), filters.TitleExcludePatterns...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid title pattern '%s': %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Merge fills in the fields left unset in settings with those of other, the fields which are set are kept. Pairs such
+// as the resolution are only filled in together.
+func (settings UserSettings) Merge(other UserSettings) UserSettings {
+	if settings.DownloadPath == "" {
+		settings.DownloadPath = other.DownloadPath
+	}
+	if settings.Width == 0 && settings.Height == 0 {
+		settings.Width, settings.Height = other.Width, other.Height
+	}
+	if settings.BackgroundsCount == 0 {
+		settings.BackgroundsCount = other.BackgroundsCount
+	}
+	if len(settings.Sources) == 0 {
+		settings.Sources = other.Sources
+	}
+	if settings.OutputFormat == "" && settings.JPEGQuality == 0 {
+		settings.OutputFormat, settings.JPEGQuality = other.OutputFormat, other.JPEGQuality
+	}
+	settings.Filters = settings.Filters.Merge(other.Filters)
+	return settings
+}
+
+// Merge fills in the filters left unset with those of other, like UserSettings.Merge
+func (filters Filters) Merge(other Filters) Filters {
+	if filters.AspectRatioTolerance == 0 {
+		filters.AspectRatioTolerance = other.AspectRatioTolerance
+	}
+	filters.TitleIncludeKeywords = mergeList(filters.TitleIncludeKeywords, other.TitleIncludeKeywords)
+	filters.TitleExcludeKeywords = mergeList(filters.TitleExcludeKeywords, other.TitleExcludeKeywords)
+	filters.TitleIncludePatterns = mergeList(filters.TitleIncludePatterns, other.TitleIncludePatterns)
+	filters.TitleExcludePatterns = mergeList(filters.TitleExcludePatterns, other.TitleExcludePatterns)
+	filters.DominantHues = mergeList(filters.DominantHues, other.DominantHues)
+	filters.IncludeLocations = mergeList(filters.IncludeLocations, other.IncludeLocations)
+	filters.ExcludeLocations = mergeList(filters.ExcludeLocations, other.ExcludeLocations)
+	if filters.Brightness == "" {
+		filters.Brightness = other.Brightness
+	}
+	if filters.MinLuminance == 0 && filters.MaxLuminance == 0 {
+		filters.MinLuminance, filters.MaxLuminance = other.MinLuminance, other.MaxLuminance
+	}
+	return filters
+}
+
+func mergeList(list []string, other []string) []string {
+	if len(list) == 0 {
+		return other
+	}
+	return list
+}
+
+func (us *UserSettingsManager) UpdateUserSettings(settings UserSettings) error {
+	settings.SchemaVersion = currentSchemaVersion
+	if settings.Sources == nil {
+		settings.Sources = []string{}
+	}
+	err := settings.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid user settings: %w", err)
+	}
+	us.Settings = settings
 	return us.saveUserSettings()
 }
 
 func (us *UserSettingsManager) saveUserSettings() error {
-	out, err := json.Marshal(us.Settings)
+	out, err := json.MarshalIndent(us.Settings, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshall user settings to json: %v", err)
 	}
-	err = ioutil.WriteFile(us.fpath, out, 0644)
-	return err
+	// Like the stored login, user data is only readable by the user
+	err = os.MkdirAll(filepath.Dir(us.fpath), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create user settings directory: %v", err)
+	}
+	err = ioutil.WriteFile(us.fpath, out, 0600)
+	if err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file, such as one written by an older version
+	return os.Chmod(us.fpath, 0600)
 }
@@ -0,0 +1,42 @@
+package user_settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdateUserSettingsFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes aren't enforced on windows")
+	}
+	for _, existing := range []bool{false, true} {
+		fpath := filepath.Join(t.TempDir(), "earthpullr", "user_settings.json")
+		if existing {
+			// Written by an older version
+			err := os.MkdirAll(filepath.Dir(fpath), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(fpath, []byte("{}"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		manager := UserSettingsManager{fpath: fpath, Settings: newDefaultUserSettings()}
+
+		err := manager.UpdateUserSettings(UserSettings{Width: 1920, Height: 1080})
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("existing file %t: user settings were written with mode %o, want 0600", existing, info.Mode().Perm())
+		}
+	}
+}
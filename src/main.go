@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"earthpullr/internal/config"
+	"earthpullr/internal/local_api"
+	"earthpullr/internal/metrics"
 	"earthpullr/internal/reddit_cli"
 	"earthpullr/pkg/log"
 	_ "embed"
+	"fmt"
 	"github.com/kbinani/screenshot"
 	"github.com/wailsapp/wails"
 	"go.uber.org/zap"
@@ -20,16 +23,41 @@ var css string
 
 func main() {
 
-	logger := log.New()
+	flags, err := parseFlags(os.Args[0], os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+	conf := getConfig(flags)
+	logger := getLogger(conf)
 	zap.ReplaceGlobals(logger)
 
-	conf := getConfig(logger, "")
+	if conf.MetricsListenAddress != "" {
+		_, err = metrics.StartServer(conf.MetricsListenAddress, logger)
+		if err != nil {
+			logger.Fatal("Failed to start metrics server", zap.Error(err))
+		}
+	}
+
+	if len(flags.args) > 0 {
+		err = runCommand(flags.args, conf, logger)
+		if err != nil {
+			logger.Fatal("Command failed", zap.String("command", flags.args[0]), zap.Error(err))
+		}
+		return
+	}
+
 	ctx := context.Background()
 	retriever, err := reddit_cli.NewBackgroundRetriever(ctx, logger, conf)
 	if err != nil {
 		logger.Fatal("Failed to create background retriever", zap.Error(err))
 		os.Exit(1)
 	}
+	if conf.ApiListenAddress != "" {
+		_, err = local_api.StartServer(conf.ApiListenAddress, conf, retriever, logger)
+		if err != nil {
+			logger.Fatal("Failed to start API server", zap.Error(err))
+		}
+	}
 
 	bounds := screenshot.GetDisplayBounds(0)
 	width := bounds.Dx()/5
@@ -47,11 +75,39 @@ func main() {
 	app.Run()
 }
 
-func getConfig(logger *zap.Logger, jsonFilePath string) config.Config {
-	conf, err := config.NewConfig(jsonFilePath)
+func getConfig(flags cliFlags) config.Config {
+	conf, err := config.NewConfig(flags.configPath)
 	if err != nil {
-		logger.Fatal("Failed to read config file, shutting down.", zap.Error(err))
+		// The logger is configured from the config so it isn't available yet
+		fmt.Fprintf(os.Stderr, "Failed to read config file, shutting down: %v\n", err)
 		os.Exit(1)
 	}
+	flags.applyToConfig(&conf)
 	return conf
 }
+
+func getLogger(conf config.Config) *zap.Logger {
+	outputPaths := conf.LogOutputPaths
+	if len(outputPaths) == 0 {
+		outputPaths = []string{"stdout"}
+		logFilePath, err := log.DefaultLogFilePath(conf.ApplicationName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to find a log file location, logging to stdout only: %v\n", err)
+		} else {
+			outputPaths = append(outputPaths, logFilePath)
+		}
+	}
+	logger, err := log.New(log.Options{
+		Level:       conf.LogLevel,
+		Encoding:    conf.LogEncoding,
+		OutputPaths: outputPaths,
+		MaxSizeMB:   conf.LogMaxSizeMB,
+		MaxAgeDays:  conf.LogMaxAgeDays,
+		MaxBackups:  conf.LogMaxBackups,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create logger, shutting down: %v\n", err)
+		os.Exit(1)
+	}
+	return logger
+}
@@ -0,0 +1,117 @@
+// Package bandwidth provides a token bucket limiting the combined throughput of any number of readers.
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const maxChunkBytes = 32 * 1024
+
+// Limiter is safe for concurrent use, a nil *Limiter applies no limit
+type Limiter struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+}
+
+// NewLimiter returns nil, meaning unlimited, when bytesPerSec is not positive
+func NewLimiter(bytesPerSec int64) *Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &Limiter{
+		bytesPerSec: float64(bytesPerSec),
+		burst:       float64(bytesPerSec),
+		tokens:      float64(bytesPerSec),
+		last:        time.Now(),
+	}
+}
+
+// WaitN blocks until n bytes may be transferred, returning how long it was throttled for. Callers reserve tokens in
+// turn so concurrent readers share the limit fairly.
+func (l *Limiter) WaitN(ctx context.Context, n int) (time.Duration, error) {
+	if l == nil || n <= 0 {
+		return 0, nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.bytesPerSec
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.bytesPerSec * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		// Return the unused reservation so other readers aren't penalised
+		l.tokens += float64(n)
+		l.mu.Unlock()
+		return 0, ctx.Err()
+	case <-timer.C:
+		return wait, nil
+	}
+}
+
+func (l *Limiter) chunkSize() int {
+	if l == nil || l.burst > maxChunkBytes {
+		return maxChunkBytes
+	}
+	return int(l.burst)
+}
+
+// Reader limits reads from an underlying reader and records the time spent throttled
+type Reader struct {
+	ctx       context.Context
+	reader    io.Reader
+	limiter   *Limiter
+	throttled time.Duration
+}
+
+func (l *Limiter) Reader(ctx context.Context, reader io.Reader) *Reader {
+	return &Reader{
+		ctx:     ctx,
+		reader:  reader,
+		limiter: l,
+	}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.limiter == nil {
+		return r.reader.Read(p)
+	}
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if chunk := r.limiter.chunkSize(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := r.reader.Read(p)
+	waited, waitErr := r.limiter.WaitN(r.ctx, n)
+	r.throttled += waited
+	if waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
+
+// Throttled is the total time this reader has waited on the limiter
+func (r *Reader) Throttled() time.Duration {
+	return r.throttled
+}
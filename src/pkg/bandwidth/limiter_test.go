@@ -0,0 +1,109 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRate = 1024 * 1024
+
+// readAll reads n bytes through a reader of the limiter, returning the time it was throttled for
+func readAll(t *testing.T, ctx context.Context, limiter *Limiter, n int) time.Duration {
+	reader := limiter.Reader(ctx, bytes.NewReader(make([]byte, n)))
+	read, err := io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		t.Error(err)
+	}
+	if read != int64(n) {
+		t.Errorf("read %d bytes, want %d", read, n)
+	}
+	return reader.Throttled()
+}
+
+func TestNilLimiterIsUnlimited(t *testing.T) {
+	if limiter := NewLimiter(0); limiter != nil {
+		t.Fatalf("expected no limit, got %+v", limiter)
+	}
+	if throttled := readAll(t, context.Background(), nil, 10*testRate); throttled != 0 {
+		t.Fatalf("throttled for %s without a limit", throttled)
+	}
+}
+
+func TestReaderRate(t *testing.T) {
+	limiter := NewLimiter(testRate)
+	start := time.Now()
+	// The first second's worth is the burst, the remaining half second is throttled
+	throttled := readAll(t, context.Background(), limiter, testRate*3/2)
+	elapsed := time.Since(start)
+
+	if throttled < 450*time.Millisecond || throttled > elapsed {
+		t.Fatalf("throttled for %s, want about 500ms and no more than the %s elapsed", throttled, elapsed)
+	}
+	if elapsed > 2*time.Second {
+		t.Fatalf("took %s to read at %d bytes per second", elapsed, testRate)
+	}
+}
+
+func TestReadersShareLimit(t *testing.T) {
+	limiter := NewLimiter(testRate)
+	start := time.Now()
+	var wg sync.WaitGroup
+	throttled := make([]time.Duration, 2)
+	for i := range throttled {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Either reader alone would fit within the burst
+			throttled[i] = readAll(t, context.Background(), limiter, testRate*3/4)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if elapsed < 450*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("took %s for both readers, want about 500ms", elapsed)
+	}
+	if throttled[0]+throttled[1] < 450*time.Millisecond {
+		t.Fatalf("readers were throttled for %s and %s, want about 500ms between them", throttled[0], throttled[1])
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	limiter := NewLimiter(1024)
+	_, err := limiter.WaitN(context.Background(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	waited, err := limiter.WaitN(ctx, 10*1024)
+	if !errors.Is(err, context.Canceled) || waited != 0 {
+		t.Fatalf("expected the wait to be cancelled, got %s waited and %v", waited, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("took %s to return after cancelling", elapsed)
+	}
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if limiter.tokens < -1024 {
+		t.Fatalf("cancelled reservation was not returned, %f tokens left", limiter.tokens)
+	}
+}
+
+func TestReaderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader := NewLimiter(testRate).Reader(ctx, bytes.NewReader(make([]byte, 1024)))
+
+	if _, err := reader.Read(make([]byte, 1024)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected reading after cancelling to fail, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Package command_hook runs user configured external commands when something happens, passing them the details as
+// environment variables and as JSON on stdin. The commands are run directly rather than through a shell, use e.g.
+// ["sh", "-c", "..."] for shell syntax.
+package command_hook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxOutputBytes of stdout and of stderr are logged, the rest is discarded
+const maxOutputBytes = 16 * 1024
+
+type Runner struct {
+	logger  *zap.Logger
+	timeout time.Duration
+}
+
+// NewRunner kills commands still running after timeout, zero doesn't time out
+func NewRunner(logger *zap.Logger, timeout time.Duration) *Runner {
+	return &Runner{logger: logger, timeout: timeout}
+}
+
+// Run waits for the command to finish, logging its output. env is added to the environment of earthpullr and payload
+// is written to stdin as JSON. An empty command does nothing.
+func (r *Runner) Run(ctx context.Context, name string, command []string, env map[string]string, payload interface{}) error {
+	if len(command) == 0 {
+		return nil
+	}
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshall payload of hook '%s': %v", name, err)
+	}
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = os.Environ()
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	// Files are used instead of pipes as children of the command, e.g. of a shell, would otherwise keep Run waiting
+	// for them to close the pipes after a timeout
+	stdin, err := tempFile(append(input, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write payload of hook '%s': %v", name, err)
+	}
+	defer removeTempFile(stdin)
+	stdout, err := tempFile(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create output file of hook '%s': %v", name, err)
+	}
+	defer removeTempFile(stdout)
+	stderr, err := tempFile(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create output file of hook '%s': %v", name, err)
+	}
+	defer removeTempFile(stderr)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	fields := []zap.Field{
+		zap.String("hook", name),
+		zap.Strings("command", command),
+		zap.Duration("duration", time.Since(start)),
+		zap.String("stdout", readOutput(stdout)),
+		zap.String("stderr", readOutput(stderr)),
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("hook '%s' timed out after %s", name, r.timeout)
+	} else if err != nil {
+		err = fmt.Errorf("hook '%s' failed: %v", name, err)
+	}
+	if err != nil {
+		r.logger.Warn("Hook command failed", append(fields, zap.Error(err))...)
+		return err
+	}
+	r.logger.Info("Hook command finished", fields...)
+	return nil
+}
+
+func tempFile(content []byte) (*os.File, error) {
+	file, err := ioutil.TempFile("", "earthpullr-hook-")
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeTempFile(file)
+		return nil, err
+	}
+	return file, nil
+}
+
+func removeTempFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// readOutput returns up to maxOutputBytes of what the command wrote to file
+func readOutput(file *os.File) string {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return ""
+	}
+	output, err := ioutil.ReadAll(io.LimitReader(file, maxOutputBytes+1))
+	if err != nil {
+		return ""
+	}
+	truncated := len(output) > maxOutputBytes
+	if truncated {
+		output = output[:maxOutputBytes]
+	}
+	text := strings.TrimRight(string(output), "\n")
+	if truncated {
+		text += "... (truncated)"
+	}
+	return text
+}
@@ -0,0 +1,123 @@
+package command_hook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// helperModeEnv makes the test binary act as a hook command, see TestHelperCommand
+const helperModeEnv = "EARTHPULLR_TEST_HOOK_MODE"
+
+// TestHelperCommand is run as the hook command by the other tests, the same binary is used so they don't depend on a
+// shell being installed
+func TestHelperCommand(t *testing.T) {
+	mode := os.Getenv(helperModeEnv)
+	if mode == "" {
+		return
+	}
+	switch mode {
+	case "echo":
+		stdin, _ := ioutil.ReadAll(os.Stdin)
+		fmt.Printf("value=%s payload=%s", os.Getenv("EARTHPULLR_TEST_VALUE"), stdin)
+	case "sleep":
+		time.Sleep(time.Minute)
+	case "fail":
+		fmt.Fprint(os.Stderr, "something broke")
+		os.Exit(3)
+	case "flood":
+		fmt.Print(strings.Repeat("x", 2*maxOutputBytes))
+	}
+	os.Exit(0)
+}
+
+func helperCommand() []string {
+	return []string{os.Args[0], "-test.run=^TestHelperCommand$"}
+}
+
+func newObservedRunner(timeout time.Duration) (*Runner, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	return NewRunner(zap.New(core), timeout), logs
+}
+
+// loggedOutput returns the output of the single hook command logged
+func loggedOutput(t *testing.T, logs *observer.ObservedLogs) (stdout string, stderr string) {
+	t.Helper()
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	return fields["stdout"].(string), fields["stderr"].(string)
+}
+
+func TestRunPassesEnvAndPayload(t *testing.T) {
+	runner, logs := newObservedRunner(10 * time.Second)
+	env := map[string]string{helperModeEnv: "echo", "EARTHPULLR_TEST_VALUE": "lake"}
+	payload := map[string]string{"event": "image_saved"}
+
+	err := runner.Run(context.Background(), "image_saved", helperCommand(), env, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, _ := loggedOutput(t, logs)
+	if want := `value=lake payload={"event":"image_saved"}`; stdout != want {
+		t.Fatalf("got stdout '%s', want '%s'", stdout, want)
+	}
+}
+
+func TestRunTimesOut(t *testing.T) {
+	runner, _ := newObservedRunner(200 * time.Millisecond)
+	start := time.Now()
+
+	err := runner.Run(context.Background(), "image_saved", helperCommand(), map[string]string{helperModeEnv: "sleep"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected the hook to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("took %s to kill the hook", elapsed)
+	}
+}
+
+func TestRunFails(t *testing.T) {
+	runner, logs := newObservedRunner(10 * time.Second)
+
+	err := runner.Run(context.Background(), "image_saved", helperCommand(), map[string]string{helperModeEnv: "fail"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("expected the exit status to be returned, got %v", err)
+	}
+	_, stderr := loggedOutput(t, logs)
+	if stderr != "something broke" {
+		t.Fatalf("got stderr '%s', want it logged", stderr)
+	}
+}
+
+func TestRunTruncatesOutput(t *testing.T) {
+	runner, logs := newObservedRunner(10 * time.Second)
+
+	err := runner.Run(context.Background(), "image_saved", helperCommand(), map[string]string{helperModeEnv: "flood"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, _ := loggedOutput(t, logs)
+	if want := strings.Repeat("x", maxOutputBytes) + "... (truncated)"; stdout != want {
+		t.Fatalf("got %d bytes of stdout, want the first %d followed by a truncation marker", len(stdout), maxOutputBytes)
+	}
+}
+
+func TestRunEmptyCommand(t *testing.T) {
+	runner, logs := newObservedRunner(0)
+
+	err := runner.Run(context.Background(), "image_saved", nil, nil, nil)
+	if err != nil || logs.Len() != 0 {
+		t.Fatalf("expected an empty command to do nothing, got %v", err)
+	}
+}
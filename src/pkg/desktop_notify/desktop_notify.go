@@ -0,0 +1,107 @@
+// Package desktop_notify shows desktop notifications through the freedesktop org.freedesktop.Notifications D-Bus
+// service, which the notification daemons of Linux and BSD desktops provide.
+package desktop_notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+const (
+	notificationsService = "org.freedesktop.Notifications"
+	notificationsPath    = "/org/freedesktop/Notifications"
+	notifyMethod         = notificationsService + ".Notify"
+	// notifyTimeout stops a bus without a notification daemon, or a stuck daemon, holding up the caller
+	notifyTimeout = 5 * time.Second
+)
+
+type Urgency byte
+
+const (
+	UrgencyLow      Urgency = 0
+	UrgencyNormal   Urgency = 1
+	UrgencyCritical Urgency = 2
+)
+
+// Categories from the notification specification, daemons may use them to choose an icon or sound
+const (
+	CategoryTransferComplete = "transfer.complete"
+	CategoryTransferError    = "transfer.error"
+)
+
+type Notification struct {
+	Summary string
+	Body    string
+	// ImagePath is shown as the notification's image when set
+	ImagePath string
+	Urgency   Urgency
+	Category  string
+}
+
+// Sender is implemented by DBusSender, callers depend on it so they can run without a session bus
+type Sender interface {
+	Notify(notification Notification) error
+	Close() error
+}
+
+type DBusSender struct {
+	conn    *dbus.Conn
+	appName string
+}
+
+// NewDBusSender sends notifications over conn, which may be a connection to any bus such as a private dbus-daemon
+func NewDBusSender(conn *dbus.Conn, appName string) *DBusSender {
+	return &DBusSender{conn: conn, appName: appName}
+}
+
+// ConnectSessionBus connects to the session bus of DBUS_SESSION_BUS_ADDRESS, or of the desktop when it's unset
+func ConnectSessionBus(appName string) (*DBusSender, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the D-Bus session bus: %v", err)
+	}
+	return NewDBusSender(conn, appName), nil
+}
+
+func (s *DBusSender) Notify(notification Notification) error {
+	hints := map[string]dbus.Variant{
+		"urgency": dbus.MakeVariant(byte(notification.Urgency)),
+	}
+	if notification.Category != "" {
+		hints["category"] = dbus.MakeVariant(notification.Category)
+	}
+	if notification.ImagePath != "" {
+		imagePath, err := filepath.Abs(notification.ImagePath)
+		if err != nil {
+			return err
+		}
+		hints["image-path"] = dbus.MakeVariant((&url.URL{Scheme: "file", Path: imagePath}).String())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	call := s.conn.Object(notificationsService, notificationsPath).CallWithContext(
+		ctx,
+		notifyMethod,
+		0,
+		s.appName,
+		uint32(0), // replaces_id, zero creates a new notification
+		"",        // app_icon
+		notification.Summary,
+		notification.Body,
+		[]string{}, // actions
+		hints,
+		int32(-1), // expire_timeout, -1 leaves it to the daemon
+	)
+	if call.Err != nil {
+		return fmt.Errorf("failed to send desktop notification: %v", call.Err)
+	}
+	return nil
+}
+
+func (s *DBusSender) Close() error {
+	return s.conn.Close()
+}
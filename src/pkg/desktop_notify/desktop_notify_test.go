@@ -0,0 +1,123 @@
+package desktop_notify
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type receivedNotification struct {
+	appName string
+	summary string
+	body    string
+	hints   map[string]dbus.Variant
+}
+
+// notificationDaemon records the notifications sent to it like a desktop's notification daemon would show them
+type notificationDaemon struct {
+	mu       sync.Mutex
+	received []receivedNotification
+}
+
+func (daemon *notificationDaemon) Notify(appName string, replacesID uint32, appIcon string, summary string, body string, actions []string, hints map[string]dbus.Variant, expireTimeout int32) (uint32, *dbus.Error) {
+	daemon.mu.Lock()
+	defer daemon.mu.Unlock()
+	daemon.received = append(daemon.received, receivedNotification{appName: appName, summary: summary, body: body, hints: hints})
+	return uint32(len(daemon.received)), nil
+}
+
+// startSessionBus runs a private dbus-daemon for the test, returning its address
+func startSessionBus(t *testing.T) string {
+	t.Helper()
+	daemonPath, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	cmd := exec.Command(daemonPath, "--session", "--print-address", "--nofork")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read the dbus-daemon address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestDBusSenderNotify(t *testing.T) {
+	address := startSessionBus(t)
+	daemonConn := connect(t, address)
+	daemon := &notificationDaemon{}
+	err := daemonConn.Export(daemon, notificationsPath, notificationsService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := daemonConn.RequestName(notificationsService, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", notificationsService, err)
+	}
+
+	sender := NewDBusSender(connect(t, address), "earthpullr")
+	err = sender.Notify(Notification{
+		Summary:   "Saved 3 of 3 backgrounds",
+		Body:      "/backgrounds",
+		ImagePath: "/backgrounds/lake.jpg",
+		Urgency:   UrgencyLow,
+		Category:  CategoryTransferComplete,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	daemon.mu.Lock()
+	defer daemon.mu.Unlock()
+	if len(daemon.received) != 1 {
+		t.Fatalf("daemon received %d notifications, want 1", len(daemon.received))
+	}
+	got := daemon.received[0]
+	if got.appName != "earthpullr" || got.summary != "Saved 3 of 3 backgrounds" || got.body != "/backgrounds" {
+		t.Fatalf("got %+v", got)
+	}
+	if urgency, ok := got.hints["urgency"].Value().(byte); !ok || Urgency(urgency) != UrgencyLow {
+		t.Fatalf("got urgency hint %v", got.hints["urgency"])
+	}
+	if category, ok := got.hints["category"].Value().(string); !ok || category != CategoryTransferComplete {
+		t.Fatalf("got category hint %v", got.hints["category"])
+	}
+	if imagePath, ok := got.hints["image-path"].Value().(string); !ok || imagePath != "file:///backgrounds/lake.jpg" {
+		t.Fatalf("got image-path hint %v", got.hints["image-path"])
+	}
+}
+
+func TestDBusSenderWithoutNotificationDaemon(t *testing.T) {
+	address := startSessionBus(t)
+	sender := NewDBusSender(connect(t, address), "earthpullr")
+
+	err := sender.Notify(Notification{Summary: "Saved 3 of 3 backgrounds"})
+	if err == nil {
+		t.Fatal("expected notifying a bus without a notification daemon to fail")
+	}
+}
@@ -0,0 +1,220 @@
+// Package dir_lock is an advisory lock file stopping two processes using a directory at the same time. Locks left
+// behind by processes which crashed are detected from the PID and host written into the lock file.
+package dir_lock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	pollInterval         = time.Second
+	malformedLockTimeout = 10 * time.Second
+	// takeoverSuffix is appended to the lock file name for the file guarding the take over of a stale lock
+	takeoverSuffix = ".takeover"
+)
+
+type Owner struct {
+	PID        int       `json:"pid"`
+	Host       string    `json:"host"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// LockedError is returned when another live process holds the lock
+type LockedError struct {
+	Path  string
+	Owner Owner
+}
+
+func (err *LockedError) Error() string {
+	return fmt.Sprintf(
+		"'%s' is already in use by another earthpullr (pid %d on %s since %s), if it is no longer running delete '%s'",
+		filepath.Dir(err.Path),
+		err.Owner.PID,
+		err.Owner.Host,
+		err.Owner.AcquiredAt.Local().Format(time.RFC1123),
+		err.Path,
+	)
+}
+
+type Lock struct {
+	fpath string
+	owner Owner
+}
+
+// Acquire locks dir by creating the lock file fname inside it, failing with a *LockedError if it is already locked
+func Acquire(dir string, fname string) (*Lock, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host name for lock: %v", err)
+	}
+	lock := &Lock{
+		fpath: filepath.Join(dir, fname),
+		owner: Owner{PID: os.Getpid(), Host: host, AcquiredAt: time.Now().UTC()},
+	}
+	// Another attempt is made after the lock is released or changes hands while it's being checked
+	for attempt := 0; attempt < 3; attempt++ {
+		err = lock.create()
+		if !errors.Is(err, os.ErrExist) {
+			return lock, err
+		}
+		contents, owner, err := readLock(lock.fpath)
+		if errors.Is(err, os.ErrNotExist) {
+			// Released in the meantime
+			continue
+		}
+		if err != nil && !errors.Is(err, errMalformedLock) {
+			return nil, fmt.Errorf("failed to read lock '%s': %v", lock.fpath, err)
+		}
+		if !isStale(lock.fpath, owner, err, host) {
+			return nil, &LockedError{Path: lock.fpath, Owner: owner}
+		}
+		tookOver, err := lock.takeOver(contents)
+		if errors.Is(err, errTakeoverInProgress) {
+			return nil, &LockedError{Path: lock.fpath, Owner: owner}
+		} else if err != nil {
+			return nil, err
+		} else if tookOver {
+			return lock, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to acquire lock '%s'", lock.fpath)
+}
+
+// AcquireWait waits for another process to release the lock until ctx is done
+func AcquireWait(ctx context.Context, dir string, fname string) (*Lock, error) {
+	for {
+		lock, err := Acquire(dir, fname)
+		var lockedErr *LockedError
+		if !errors.As(err, &lockedErr) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up waiting for lock: %w", err)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// takeOver replaces a stale lock, as long as it still has the contents it was judged stale by, with this one. Only one
+// process at a time may take over a lock so two finding the same stale lock can't both replace it, the second deleting
+// the first's live lock. The lock is replaced by renaming so it's never missing for a third process to create.
+func (lock *Lock) takeOver(staleContents []byte) (bool, error) {
+	guardPath := lock.fpath + takeoverSuffix
+	guard, err := os.OpenFile(guardPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		// Another process is taking it over, unless it crashed while doing so
+		info, statErr := os.Stat(guardPath)
+		if statErr == nil && time.Since(info.ModTime()) > malformedLockTimeout {
+			os.Remove(guardPath)
+		}
+		return false, errTakeoverInProgress
+	} else if err != nil {
+		return false, fmt.Errorf("failed to take over stale lock '%s': %v", lock.fpath, err)
+	}
+	guard.Close()
+	defer os.Remove(guardPath)
+
+	contents, _, err := readLock(lock.fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil && !errors.Is(err, errMalformedLock) {
+		return false, fmt.Errorf("failed to read lock '%s': %v", lock.fpath, err)
+	}
+	if !bytes.Equal(contents, staleContents) {
+		// Taken over by another process before this one could
+		return false, nil
+	}
+	tmpPath := fmt.Sprintf("%s.%d.tmp", lock.fpath, lock.owner.PID)
+	err = lock.write(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return false, err
+	}
+	err = os.Rename(tmpPath, lock.fpath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return false, fmt.Errorf("failed to replace stale lock '%s': %v", lock.fpath, err)
+	}
+	return true, nil
+}
+
+func (lock *Lock) create() error {
+	return lock.write(lock.fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+}
+
+func (lock *Lock) write(fpath string, flag int) error {
+	file, err := os.OpenFile(fpath, flag, 0644)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(lock.owner)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fpath)
+		return fmt.Errorf("failed to write lock '%s': %v", fpath, err)
+	}
+	return nil
+}
+
+var (
+	errMalformedLock      = errors.New("malformed lock file")
+	errTakeoverInProgress = errors.New("another process is taking over the stale lock")
+)
+
+func readOwner(fpath string) (Owner, error) {
+	_, owner, err := readLock(fpath)
+	return owner, err
+}
+
+// readLock also returns the lock file's contents, which identify a malformed lock as well as a valid one
+func readLock(fpath string) ([]byte, Owner, error) {
+	var owner Owner
+	byteValue, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, owner, err
+	}
+	if json.Unmarshal(byteValue, &owner) != nil {
+		return byteValue, owner, errMalformedLock
+	}
+	return byteValue, owner, nil
+}
+
+// isStale is true when the owner has exited. Owners on other hosts sharing the directory can't be checked so are
+// assumed to be running. A malformed lock is either still being written or was left by a crash while writing it.
+func isStale(fpath string, owner Owner, readErr error, host string) bool {
+	if errors.Is(readErr, errMalformedLock) {
+		info, err := os.Stat(fpath)
+		return err == nil && time.Since(info.ModTime()) > malformedLockTimeout
+	}
+	return owner.Host == host && !processRunning(owner.PID)
+}
+
+// Release removes the lock file unless another process has since taken it over
+func (lock *Lock) Release() error {
+	owner, err := readOwner(lock.fpath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if owner.PID != lock.owner.PID || owner.Host != lock.owner.Host {
+		return nil
+	}
+	err = os.Remove(lock.fpath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to release lock '%s': %v", lock.fpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package dir_lock
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const lockFname = ".earthpullr.lock"
+
+// exitedPID returns the PID of a process which has already exited
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	err := cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func writeStaleLock(t *testing.T, dir string) {
+	t.Helper()
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(Owner{PID: exitedPID(t), Host: host, AcquiredAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, lockFname), out, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertOwnedBy(t *testing.T, dir string, pid int) {
+	t.Helper()
+	owner, err := readOwner(filepath.Join(dir, lockFname))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.PID != pid {
+		t.Fatalf("lock is owned by pid %d, want %d", owner.PID, pid)
+	}
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := Acquire(dir, lockFname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockedErr *LockedError
+	if _, err := Acquire(dir, lockFname); !errors.As(err, &lockedErr) || lockedErr.Owner.PID != os.Getpid() {
+		t.Fatalf("expected the held lock to be refused, got %v", err)
+	}
+	err = lock.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err = Acquire(dir, lockFname)
+	if err != nil {
+		t.Fatalf("expected the released lock to be acquired, got %v", err)
+	}
+	lock.Release()
+}
+
+func TestAcquireTakesOverStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	writeStaleLock(t, dir)
+
+	lock, err := Acquire(dir, lockFname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+	assertOwnedBy(t, dir, os.Getpid())
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected only the lock to be left in the directory, got %d files", len(files))
+	}
+}
+
+func TestAcquireTakesOverMalformedLock(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, lockFname)
+	err := ioutil.WriteFile(fpath, []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockedErr *LockedError
+	if _, err := Acquire(dir, lockFname); !errors.As(err, &lockedErr) {
+		t.Fatalf("expected a lock still being written to be refused, got %v", err)
+	}
+
+	old := time.Now().Add(-2 * malformedLockTimeout)
+	err = os.Chtimes(fpath, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := Acquire(dir, lockFname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+	assertOwnedBy(t, dir, os.Getpid())
+}
+
+func TestConcurrentTakeOverOfStaleLock(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		dir := t.TempDir()
+		writeStaleLock(t, dir)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		acquired := 0
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := Acquire(dir, lockFname)
+				var lockedErr *LockedError
+				if err != nil && !errors.As(err, &lockedErr) {
+					t.Error(err)
+				}
+				if err == nil {
+					mu.Lock()
+					acquired++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if acquired != 1 {
+			t.Fatalf("stale lock was acquired %d times, want once", acquired)
+		}
+		if _, err := os.Stat(filepath.Join(dir, lockFname+takeoverSuffix)); !os.IsNotExist(err) {
+			t.Fatalf("expected the take over guard to be removed, got %v", err)
+		}
+	}
+}
+
+func TestAcquireRemovesAbandonedTakeOver(t *testing.T) {
+	dir := t.TempDir()
+	writeStaleLock(t, dir)
+	guardPath := filepath.Join(dir, lockFname+takeoverSuffix)
+	err := ioutil.WriteFile(guardPath, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockedErr *LockedError
+	if _, err := Acquire(dir, lockFname); !errors.As(err, &lockedErr) {
+		t.Fatalf("expected a take over in progress to be waited for, got %v", err)
+	}
+
+	old := time.Now().Add(-2 * malformedLockTimeout)
+	err = os.Chtimes(guardPath, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(dir, lockFname); !errors.As(err, &lockedErr) {
+		t.Fatalf("expected the abandoned take over to be removed first, got %v", err)
+	}
+	lock, err := Acquire(dir, lockFname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+	assertOwnedBy(t, dir, os.Getpid())
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package dir_lock
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processRunning sends signal 0 which only checks the process exists, EPERM means it exists but belongs to another user
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,16 @@
+package dir_lock
+
+import "os"
+
+// processRunning relies on FindProcess opening a handle to the process on Windows, which fails if it has exited
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
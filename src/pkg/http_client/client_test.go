@@ -0,0 +1,100 @@
+package http_client
+
+import (
+	"bytes"
+	"context"
+	"earthpullr/pkg/bandwidth"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledDownloadOutlastsTimeout(t *testing.T) {
+	const timeout = 500 * time.Millisecond
+	const bytesPerSec = 20000
+	body := bytes.Repeat([]byte("x"), 3*bytesPerSec)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+	client, err := New(Options{Timeout: timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	limited := bandwidth.NewLimiter(bytesPerSec).Reader(context.Background(), res.Body)
+	got, err := ioutil.ReadAll(limited)
+	if err != nil {
+		t.Fatalf("throttled download failed after %s: %v", time.Since(start), err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(body))
+	}
+	if elapsed := time.Since(start); elapsed < 3*timeout {
+		t.Fatalf("download took %s, expected throttling to take longer than the timeout", elapsed)
+	}
+}
+
+func TestStalledBodyTimesOut(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	client, err := New(Options{Timeout: timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	start := time.Now()
+	_, err = ioutil.ReadAll(res.Body)
+	if err == nil || !strings.Contains(err.Error(), "no response data received") {
+		t.Fatalf("expected an idle timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*timeout {
+		t.Fatalf("idle timeout took %s", elapsed)
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	client, err := New(Options{Timeout: timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Get(server.URL)
+	if err == nil {
+		t.Fatal("expected waiting for the response headers to time out")
+	}
+}
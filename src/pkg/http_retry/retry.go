@@ -0,0 +1,123 @@
+package http_retry
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	ReasonNetworkError = "network_error"
+	ReasonRateLimited  = "rate_limited"
+	ReasonServerError  = "server_error"
+)
+
+type Policy struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxWait     time.Duration
+}
+
+// Observer is notified of retries so callers can instrument them, either func may be nil
+type Observer struct {
+	OnRetry         func(reason string)
+	OnRateLimitWait func(wait time.Duration)
+}
+
+func NewPolicy(maxAttempts int) Policy {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return Policy{
+		MaxAttempts: maxAttempts,
+		BaseBackoff: time.Second,
+		MaxWait:     time.Minute,
+	}
+}
+
+// Do sends the request, retrying network errors, 429 and 5xx responses. The final response is returned as is so the
+// caller can handle its status code.
+func Do(client *http.Client, req *http.Request, policy Policy, observer Observer) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		attemptReq, err := cloneRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Do(attemptReq)
+		reason := retryReason(res, err)
+		if reason == "" || attempt >= policy.MaxAttempts {
+			return res, err
+		}
+
+		wait := policy.backoff(attempt)
+		if res != nil {
+			if retryAfter, ok := rateLimitReset(res); ok {
+				wait = retryAfter
+			}
+			res.Body.Close()
+		}
+		if wait > policy.MaxWait {
+			wait = policy.MaxWait
+		}
+		if observer.OnRetry != nil {
+			observer.OnRetry(reason)
+		}
+		if reason == ReasonRateLimited && observer.OnRateLimitWait != nil {
+			observer.OnRateLimitWait(wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retryReason(res *http.Response, err error) string {
+	if err != nil {
+		return ReasonNetworkError
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return ReasonRateLimited
+	}
+	if res.StatusCode >= 500 {
+		return ReasonServerError
+	}
+	return ""
+}
+
+func (policy Policy) backoff(attempt int) time.Duration {
+	return time.Duration(float64(policy.BaseBackoff) * math.Pow(2, float64(attempt-1)))
+}
+
+// rateLimitReset reads how long the server asked us to wait, reddit uses x-ratelimit-reset over Retry-After
+func rateLimitReset(res *http.Response) (time.Duration, bool) {
+	for _, header := range []string{"Retry-After", "X-Ratelimit-Reset"} {
+		value := res.Header.Get(header)
+		if value == "" {
+			continue
+		}
+		secs, err := strconv.ParseFloat(value, 64)
+		if err == nil && secs >= 0 {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+	}
+	return 0, false
+}
+
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind request body for retry: %v", err)
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
@@ -0,0 +1,143 @@
+package http_retry
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// respondWith serves the statuses in order, the last one for any further requests, recording each request body
+func respondWith(t *testing.T, statuses []int, header http.Header) (*httptest.Server, *[]string) {
+	t.Helper()
+	var count int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		i := int(atomic.AddInt32(&count, 1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statuses[i])
+	}))
+	t.Cleanup(server.Close)
+	return server, &bodies
+}
+
+func testPolicy(maxAttempts int) Policy {
+	return Policy{MaxAttempts: maxAttempts, BaseBackoff: time.Millisecond, MaxWait: time.Second}
+}
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	server, bodies := respondWith(t, []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}, nil)
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	var waits []time.Duration
+	observer := Observer{
+		OnRetry:         func(reason string) { reasons = append(reasons, reason) },
+		OnRateLimitWait: func(wait time.Duration) { waits = append(waits, wait) },
+	}
+
+	res, err := Do(server.Client(), req, testPolicy(3), observer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", res.StatusCode)
+	}
+	if strings.Join(reasons, ",") != ReasonRateLimited+","+ReasonServerError {
+		t.Fatalf("got retry reasons %v", reasons)
+	}
+	if len(waits) != 1 {
+		t.Fatalf("got %d rate limit waits, want 1", len(waits))
+	}
+	for i, body := range *bodies {
+		if body != "grant_type=client_credentials" {
+			t.Fatalf("attempt %d sent body '%s', the body wasn't rewound", i+1, body)
+		}
+	}
+}
+
+func TestDoReturnsFinalResponseAfterMaxAttempts(t *testing.T) {
+	server, bodies := respondWith(t, []int{http.StatusTooManyRequests}, nil)
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Do(server.Client(), req, testPolicy(2), Observer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests || len(*bodies) != 2 {
+		t.Fatalf("got status %d after %d attempts, want 429 after 2", res.StatusCode, len(*bodies))
+	}
+}
+
+func TestDoDoesNotRetryClientErrors(t *testing.T) {
+	server, bodies := respondWith(t, []int{http.StatusNotFound}, nil)
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Do(server.Client(), req, testPolicy(3), Observer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(*bodies) != 1 {
+		t.Fatalf("made %d attempts, want 1", len(*bodies))
+	}
+}
+
+func TestDoHonoursRateLimitReset(t *testing.T) {
+	server, _ := respondWith(t, []int{http.StatusTooManyRequests, http.StatusOK}, http.Header{"X-Ratelimit-Reset": {"0.2"}})
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wait time.Duration
+	observer := Observer{OnRateLimitWait: func(w time.Duration) { wait = w }}
+
+	res, err := Do(server.Client(), req, testPolicy(2), observer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if wait != 200*time.Millisecond {
+		t.Fatalf("waited %s, want the 200ms reddit asked for", wait)
+	}
+}
+
+func TestDoStopsWaitingWhenCancelled(t *testing.T) {
+	server, _ := respondWith(t, []int{http.StatusTooManyRequests}, http.Header{"Retry-After": {"30"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = Do(server.Client(), req, Policy{MaxAttempts: 2, BaseBackoff: time.Millisecond, MaxWait: time.Minute}, Observer{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the wait to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancelled wait took %s", elapsed)
+	}
+}
@@ -0,0 +1,202 @@
+// Package image_colour summarises the colours of an image so backgrounds can be chosen by mood or time of day.
+package image_colour
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	// Roughly this many pixels are sampled regardless of the image size
+	targetSamples = 40000
+	paletteSize   = 5
+	// Each channel is quantised to this many bits when grouping pixels into palette colours
+	quantiseBits = 3
+	// Pixels less saturated or darker than these have no meaningful hue
+	minSaturation = 0.2
+	minValue      = 0.15
+	// At least this share of the image must be colourful for it to have a dominant hue
+	minColourfulShare = 0.2
+)
+
+// Hue families an image can be dominated by, HueNeutral is used for greyscale or washed out images
+const (
+	HueRed     = "red"
+	HueOrange  = "orange"
+	HueYellow  = "yellow"
+	HueGreen   = "green"
+	HueCyan    = "cyan"
+	HueBlue    = "blue"
+	HuePurple  = "purple"
+	HuePink    = "pink"
+	HueNeutral = "neutral"
+)
+
+var Hues = []string{HueRed, HueOrange, HueYellow, HueGreen, HueCyan, HueBlue, HuePurple, HuePink, HueNeutral}
+
+type PaletteColour struct {
+	Hex string `json:"hex"`
+	// Share is the fraction of the image closest to this colour
+	Share float64 `json:"share"`
+}
+
+type Analysis struct {
+	Palette []PaletteColour `json:"palette"`
+	// MeanLuminance is the average perceived lightness (CIE L*) from 0 (black) to 1 (white), mid grey is about 0.5
+	MeanLuminance float64 `json:"mean_luminance"`
+	DominantHue   string  `json:"dominant_hue"`
+}
+
+type bucket struct {
+	count   int
+	r, g, b float64
+}
+
+func Analyse(img image.Image) Analysis {
+	bounds := img.Bounds()
+	step := int(math.Sqrt(float64(bounds.Dx()*bounds.Dy()) / targetSamples))
+	if step < 1 {
+		step = 1
+	}
+	buckets := map[uint32]*bucket{}
+	hueWeights := map[string]int{}
+	var luminanceTotal float64
+	samples := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r16, g16, b16, _ := img.At(x, y).RGBA()
+			r, g, b := float64(r16)/0xffff, float64(g16)/0xffff, float64(b16)/0xffff
+			luminanceTotal += lightness(r, g, b)
+			samples++
+
+			key := uint32(r16>>(16-quantiseBits))<<(2*quantiseBits) | uint32(g16>>(16-quantiseBits))<<quantiseBits | uint32(b16>>(16-quantiseBits))
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += r
+			bk.g += g
+			bk.b += b
+
+			if hue, ok := hueFamily(r, g, b); ok {
+				hueWeights[hue]++
+			}
+		}
+	}
+	if samples == 0 {
+		return Analysis{DominantHue: HueNeutral}
+	}
+	return Analysis{
+		Palette:       palette(buckets, samples),
+		MeanLuminance: math.Round(luminanceTotal/float64(samples)*1000) / 1000,
+		DominantHue:   dominantHue(hueWeights, samples),
+	}
+}
+
+func palette(buckets map[uint32]*bucket, samples int) []PaletteColour {
+	var sorted []*bucket
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].count > sorted[j].count
+	})
+	var colours []PaletteColour
+	for i := 0; i < len(sorted) && i < paletteSize; i++ {
+		bk := sorted[i]
+		n := float64(bk.count)
+		colours = append(colours, PaletteColour{
+			Hex:   fmt.Sprintf("#%02x%02x%02x", to8Bit(bk.r/n), to8Bit(bk.g/n), to8Bit(bk.b/n)),
+			Share: math.Round(n/float64(samples)*1000) / 1000,
+		})
+	}
+	return colours
+}
+
+func dominantHue(hueWeights map[string]int, samples int) string {
+	best, bestWeight, colourful := HueNeutral, 0, 0
+	for _, hue := range Hues {
+		weight := hueWeights[hue]
+		colourful += weight
+		if weight > bestWeight {
+			best, bestWeight = hue, weight
+		}
+	}
+	if float64(colourful)/float64(samples) < minColourfulShare {
+		return HueNeutral
+	}
+	return best
+}
+
+// hueFamily returns false for pixels without a meaningful hue
+func hueFamily(r, g, b float64) (string, bool) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	if max < minValue || max == 0 || (max-min)/max < minSaturation {
+		return "", false
+	}
+	var hue float64
+	switch max {
+	case r:
+		hue = math.Mod((g-b)/(max-min), 6)
+	case g:
+		hue = (b-r)/(max-min) + 2
+	default:
+		hue = (r-g)/(max-min) + 4
+	}
+	hue *= 60
+	if hue < 0 {
+		hue += 360
+	}
+	switch {
+	case hue < 15 || hue >= 345:
+		return HueRed, true
+	case hue < 45:
+		return HueOrange, true
+	case hue < 70:
+		return HueYellow, true
+	case hue < 160:
+		return HueGreen, true
+	case hue < 200:
+		return HueCyan, true
+	case hue < 260:
+		return HueBlue, true
+	case hue < 290:
+		return HuePurple, true
+	default:
+		return HuePink, true
+	}
+}
+
+// lightness converts sRGB to CIE L* scaled to between 0 and 1
+func lightness(r, g, b float64) float64 {
+	y := 0.2126*linearise(r) + 0.7152*linearise(g) + 0.0722*linearise(b)
+	if y <= 216.0/24389 {
+		return y * 24389 / 27 / 100
+	}
+	return (116*math.Cbrt(y) - 16) / 100
+}
+
+func linearise(channel float64) float64 {
+	if channel <= 0.04045 {
+		return channel / 12.92
+	}
+	return math.Pow((channel+0.055)/1.055, 2.4)
+}
+
+func to8Bit(channel float64) uint8 {
+	return uint8(math.Round(channel * 255))
+}
+
+func IsHue(hue string) bool {
+	for _, h := range Hues {
+		if h == hue {
+			return true
+		}
+	}
+	return false
+}
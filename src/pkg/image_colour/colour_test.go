@@ -0,0 +1,131 @@
+package image_colour
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func solid(c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 180))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: c}, image.Point{}, draw.Src)
+	return img
+}
+
+// hsv returns a fully saturated and bright colour of the hue in degrees
+func hsv(hue float64) (r, g, b float64) {
+	x := 1 - math.Abs(math.Mod(hue/60, 2)-1)
+	switch {
+	case hue < 60:
+		return 1, x, 0
+	case hue < 120:
+		return x, 1, 0
+	case hue < 180:
+		return 0, 1, x
+	case hue < 240:
+		return 0, x, 1
+	case hue < 300:
+		return x, 0, 1
+	default:
+		return 1, 0, x
+	}
+}
+
+func TestAnalyseSolidColours(t *testing.T) {
+	tests := []struct {
+		name          string
+		colour        color.RGBA
+		wantHue       string
+		wantLuminance float64
+	}{
+		{name: "black", colour: color.RGBA{0, 0, 0, 255}, wantHue: HueNeutral, wantLuminance: 0},
+		{name: "white", colour: color.RGBA{255, 255, 255, 255}, wantHue: HueNeutral, wantLuminance: 1},
+		{name: "mid grey", colour: color.RGBA{119, 119, 119, 255}, wantHue: HueNeutral, wantLuminance: 0.5},
+		{name: "too dark for a hue", colour: color.RGBA{30, 0, 0, 255}, wantHue: HueNeutral, wantLuminance: 0.03},
+		{name: "washed out", colour: color.RGBA{200, 190, 190, 255}, wantHue: HueNeutral, wantLuminance: 0.77},
+		{name: "red", colour: color.RGBA{255, 0, 0, 255}, wantHue: HueRed, wantLuminance: 0.532},
+		{name: "orange", colour: color.RGBA{255, 128, 0, 255}, wantHue: HueOrange, wantLuminance: 0.67},
+		{name: "yellow", colour: color.RGBA{255, 255, 0, 255}, wantHue: HueYellow, wantLuminance: 0.971},
+		{name: "green", colour: color.RGBA{0, 160, 0, 255}, wantHue: HueGreen, wantLuminance: 0.57},
+		{name: "cyan", colour: color.RGBA{0, 255, 255, 255}, wantHue: HueCyan, wantLuminance: 0.911},
+		{name: "blue", colour: color.RGBA{0, 0, 255, 255}, wantHue: HueBlue, wantLuminance: 0.323},
+		{name: "purple", colour: color.RGBA{128, 0, 255, 255}, wantHue: HuePurple, wantLuminance: 0.409},
+		{name: "pink", colour: color.RGBA{255, 0, 160, 255}, wantHue: HuePink, wantLuminance: 0.56},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			analysis := Analyse(solid(test.colour))
+			if analysis.DominantHue != test.wantHue {
+				t.Fatalf("got dominant hue %s, want %s", analysis.DominantHue, test.wantHue)
+			}
+			if math.Abs(analysis.MeanLuminance-test.wantLuminance) > 0.02 {
+				t.Fatalf("got luminance %.3f, want about %.3f", analysis.MeanLuminance, test.wantLuminance)
+			}
+			if len(analysis.Palette) != 1 || analysis.Palette[0].Share != 1 {
+				t.Fatalf("expected a single palette colour covering the image, got %+v", analysis.Palette)
+			}
+			if want := fmt.Sprintf("#%02x%02x%02x", test.colour.R, test.colour.G, test.colour.B); analysis.Palette[0].Hex != want {
+				t.Fatalf("got palette colour %s, want %s", analysis.Palette[0].Hex, want)
+			}
+		})
+	}
+}
+
+func TestHueWrapAround(t *testing.T) {
+	tests := []struct {
+		hue  float64
+		want string
+	}{
+		{hue: 0, want: HueRed},
+		{hue: 5, want: HueRed},
+		{hue: 14.9, want: HueRed},
+		{hue: 15, want: HueOrange},
+		{hue: 344.9, want: HuePink},
+		{hue: 345, want: HueRed},
+		{hue: 355, want: HueRed},
+		{hue: 359.9, want: HueRed},
+	}
+	for _, test := range tests {
+		got, ok := hueFamily(hsv(test.hue))
+		if !ok || got != test.want {
+			t.Fatalf("got %s for hue %.1f, want %s", got, test.hue, test.want)
+		}
+	}
+
+	// Either side of 0 through the 8 bit colours of an image
+	for _, c := range []color.RGBA{{255, 0, 9, 255}, {255, 9, 0, 255}} {
+		if hue := Analyse(solid(c)).DominantHue; hue != HueRed {
+			t.Fatalf("got dominant hue %s for %v, want red", hue, c)
+		}
+	}
+}
+
+func TestAnalyseMixedImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(img, image.Rect(0, 0, 300, 150), &image.Uniform{C: color.RGBA{0, 0, 255, 255}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 150, 300, 200), &image.Uniform{C: color.RGBA{128, 128, 128, 255}}, image.Point{}, draw.Src)
+
+	analysis := Analyse(img)
+	if analysis.DominantHue != HueBlue {
+		t.Fatalf("got dominant hue %s, want blue", analysis.DominantHue)
+	}
+	if len(analysis.Palette) != 2 || analysis.Palette[0].Hex != "#0000ff" || analysis.Palette[0].Share != 0.75 || analysis.Palette[1].Share != 0.25 {
+		t.Fatalf("got palette %+v, want blue covering 3/4 then grey", analysis.Palette)
+	}
+
+	// Too little of the image is colourful for it to have a hue
+	draw.Draw(img, image.Rect(0, 0, 300, 170), &image.Uniform{C: color.RGBA{128, 128, 128, 255}}, image.Point{}, draw.Src)
+	if hue := Analyse(img).DominantHue; hue != HueNeutral {
+		t.Fatalf("got dominant hue %s for a mostly grey image, want neutral", hue)
+	}
+}
+
+func TestAnalyseEmptyImage(t *testing.T) {
+	analysis := Analyse(image.NewRGBA(image.Rect(0, 0, 0, 0)))
+	if analysis.DominantHue != HueNeutral || len(analysis.Palette) != 0 {
+		t.Fatalf("got %+v for an empty image", analysis)
+	}
+}
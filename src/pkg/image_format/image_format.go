@@ -0,0 +1,106 @@
+// Package image_format decodes the image formats backgrounds are served in and encodes them into the formats they can
+// be saved as. Only pure Go decoders are used so no system libraries are needed.
+package image_format
+
+import (
+	"bytes"
+	"fmt"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+)
+
+// Formats as named by image.Decode
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	GIF  = "gif"
+	WebP = "webp"
+)
+
+const DefaultJPEGQuality = 90
+
+var extensions = map[string]string{
+	JPEG: ".jpg",
+	PNG:  ".png",
+	GIF:  ".gif",
+	WebP: ".webp",
+}
+
+// Extension returns the file extension, including the dot, for a format
+func Extension(format string) (string, error) {
+	ext, ok := extensions[format]
+	if !ok {
+		return "", fmt.Errorf("unsupported image format '%s'", format)
+	}
+	return ext, nil
+}
+
+// FormatOfExtension returns the format of a file extension such as ".jpeg", or an empty string if it isn't supported
+func FormatOfExtension(ext string) string {
+	if ext == ".jpeg" {
+		return JPEG
+	}
+	for format, formatExt := range extensions {
+		if ext == formatExt {
+			return format
+		}
+	}
+	return ""
+}
+
+// SniffLen is enough of the start of a file for Sniff to recognise every format
+const SniffLen = 12
+
+// Sniff returns the format of an image from its magic bytes, or an empty string if it isn't a supported image
+func Sniff(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("\xff\xd8\xff")):
+		return JPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return GIF
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return WebP
+	}
+	return ""
+}
+
+// DecodeFile returns the image and its detected format, animated GIFs are decoded as their first frame
+func DecodeFile(fpath string) (image.Image, string, error) {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	return Decode(file)
+}
+
+// Decode returns the image and its detected format from a reader
+func Decode(r io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	return img, format, nil
+}
+
+// Encode writes the image as a JPEG or PNG, jpegQuality is between 1 and 100 and zero uses DefaultJPEGQuality
+func Encode(w io.Writer, img image.Image, format string, jpegQuality int) error {
+	switch format {
+	case JPEG:
+		if jpegQuality == 0 {
+			jpegQuality = DefaultJPEGQuality
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case PNG:
+		return png.Encode(w, img)
+	default:
+		return fmt.Errorf("images can't be encoded as '%s'", format)
+	}
+}
@@ -0,0 +1,105 @@
+package image_format
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 36))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 36; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 7), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		format  string
+		quality int
+	}{
+		{format: JPEG, quality: 0},
+		{format: JPEG, quality: 10},
+		{format: JPEG, quality: 100},
+		{format: PNG},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := Encode(&buf, testImage(), test.format, test.quality)
+		if err != nil {
+			t.Fatalf("%s at quality %d: %v", test.format, test.quality, err)
+		}
+		if sniffed := Sniff(buf.Bytes()); sniffed != test.format {
+			t.Fatalf("encoded %s sniffed as '%s'", test.format, sniffed)
+		}
+		img, format, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != test.format || img.Bounds() != testImage().Bounds() {
+			t.Fatalf("decoded a %s of %v, want a %s of %v", format, img.Bounds(), test.format, testImage().Bounds())
+		}
+	}
+
+	for _, format := range []string{GIF, WebP, "bmp"} {
+		if err := Encode(&bytes.Buffer{}, testImage(), format, 0); err == nil {
+			t.Fatalf("expected encoding as %s to fail", format)
+		}
+	}
+}
+
+func TestEncodeJPEGQuality(t *testing.T) {
+	sizes := map[int]int{}
+	for _, quality := range []int{0, 10, DefaultJPEGQuality} {
+		var buf bytes.Buffer
+		err := Encode(&buf, testImage(), JPEG, quality)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[quality] = buf.Len()
+	}
+	if sizes[0] != sizes[DefaultJPEGQuality] {
+		t.Fatalf("a quality of zero encoded %d bytes, want the %d bytes of the default quality", sizes[0], sizes[DefaultJPEGQuality])
+	}
+	if sizes[10] >= sizes[DefaultJPEGQuality] {
+		t.Fatalf("a quality of 10 encoded %d bytes, want fewer than the %d bytes of the default quality", sizes[10], sizes[DefaultJPEGQuality])
+	}
+}
+
+func TestExtension(t *testing.T) {
+	for format, want := range map[string]string{JPEG: ".jpg", PNG: ".png", GIF: ".gif", WebP: ".webp"} {
+		ext, err := Extension(format)
+		if err != nil || ext != want {
+			t.Fatalf("got extension '%s' and %v for %s, want '%s'", ext, err, format, want)
+		}
+		if got := FormatOfExtension(ext); got != format {
+			t.Fatalf("got format '%s' of '%s', want '%s'", got, ext, format)
+		}
+	}
+	if _, err := Extension("bmp"); err == nil {
+		t.Fatal("expected an unsupported format to have no extension")
+	}
+}
+
+func TestFormatOfExtension(t *testing.T) {
+	tests := map[string]string{
+		".jpg":  JPEG,
+		".jpeg": JPEG,
+		".png":  PNG,
+		".gif":  GIF,
+		".webp": WebP,
+		".JPG":  "",
+		".bmp":  "",
+		"jpg":   "",
+		"":      "",
+	}
+	for ext, want := range tests {
+		if got := FormatOfExtension(ext); got != want {
+			t.Fatalf("got format '%s' of '%s', want '%s'", got, ext, want)
+		}
+	}
+}
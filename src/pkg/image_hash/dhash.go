@@ -0,0 +1,124 @@
+// Package image_hash computes perceptual hashes so the same picture is recognised after being resized or
+// re-encoded, e.g. when it is reposted.
+package image_hash
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"os"
+	"strconv"
+)
+
+const (
+	hashWidth  = 9
+	hashHeight = 8
+	// Each cell of the downscaled image averages at most samplesPerCell^2 pixels to keep hashing large images fast
+	samplesPerCell = 16
+)
+
+// Hash is a 64 bit difference hash, images which look alike have hashes with a small Distance
+type Hash uint64
+
+// DHash decodes the image and hashes it
+func DHash(r io.Reader) (Hash, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image: %v", err)
+	}
+	return DHashImage(img), nil
+}
+
+// DHashImage hashes the image by comparing the brightness of neighbouring cells in a 9x8 grid
+func DHashImage(img image.Image) Hash {
+	var grid [hashHeight][hashWidth]float64
+	bounds := img.Bounds()
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth; x++ {
+			grid[y][x] = cellLuminance(img, bounds, x, y)
+		}
+	}
+	var hash Hash
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if grid[y][x] < grid[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// DHashFile hashes the image stored at fpath
+func DHashFile(fpath string) (Hash, error) {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return DHash(file)
+}
+
+func cellLuminance(img image.Image, bounds image.Rectangle, cellX int, cellY int) float64 {
+	x0 := bounds.Min.X + cellX*bounds.Dx()/hashWidth
+	x1 := bounds.Min.X + (cellX+1)*bounds.Dx()/hashWidth
+	y0 := bounds.Min.Y + cellY*bounds.Dy()/hashHeight
+	y1 := bounds.Min.Y + (cellY+1)*bounds.Dy()/hashHeight
+	stepX := maxInt(1, (x1-x0)/samplesPerCell)
+	stepY := maxInt(1, (y1-y0)/samplesPerCell)
+	var total float64
+	samples := 0
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			total += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			samples++
+		}
+	}
+	if samples == 0 {
+		return 0
+	}
+	return total / float64(samples)
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Distance is the number of differing bits between two hashes
+func Distance(a Hash, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+func (hash Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(hash))
+}
+
+func Parse(raw string) (Hash, error) {
+	value, err := strconv.ParseUint(raw, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid image hash '%s': %v", raw, err)
+	}
+	return Hash(value), nil
+}
+
+// MarshalText stores hashes as hex strings, JSON numbers can't hold every uint64 exactly
+func (hash Hash) MarshalText() ([]byte, error) {
+	return []byte(hash.String()), nil
+}
+
+func (hash *Hash) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*hash = parsed
+	return nil
+}
@@ -1,33 +1,122 @@
 package log
 
 import (
-	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func New() *zap.Logger {
-	rawJSON := []byte(`{
-	  "level": "debug",
-	  "encoding": "json",
-	  "outputPaths": ["stdout", "/tmp/logs"],
-	  "errorOutputPaths": ["stderr"],
-	  "initialFields": {},
-	  "encoderConfig": {
-	    "messageKey": "message",
-	    "levelKey": "level",
-	    "levelEncoder": "lowercase"
-	  }
-	}`)
+type Options struct {
+	Level       string
+	Encoding    string
+	OutputPaths []string
+	// Rotation only applies to file outputs. A zero MaxSizeMB rotates at lumberjack's default of 100MB, a zero
+	// MaxAgeDays or MaxBackups keeps old log files regardless of their age or number.
+	MaxSizeMB  int
+	MaxAgeDays int
+	MaxBackups int
+}
 
-	var cfg zap.Config
-	if err := json.Unmarshal(rawJSON, &cfg); err != nil {
-		panic(err)
+func New(opts Options) (*zap.Logger, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level '%s': %v", opts.Level, err)
 	}
-	logger, err := cfg.Build()
+	encoder, err := newEncoder(opts.Encoding)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if len(opts.OutputPaths) == 0 {
+		return nil, fmt.Errorf("at least one log output path must be specified")
 	}
+	var syncers []zapcore.WriteSyncer
+	for _, path := range opts.OutputPaths {
+		syncer, err := newWriteSyncer(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		syncers = append(syncers, newRedactingWriteSyncer(syncer))
+	}
+	core := zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(syncers...), level)
+	logger := zap.New(
+		core,
+		zap.AddCaller(),
+		zap.ErrorOutput(newRedactingWriteSyncer(zapcore.Lock(os.Stderr))),
+	)
 	defer logger.Sync()
 	logger.Info("logger construction succeeded")
-	return logger
+	return logger, nil
+}
+
+func newEncoder(encoding string) (zapcore.Encoder, error) {
+	encoderConfig := zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		MessageKey:     "message",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+	switch encoding {
+	case "json":
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	case "console":
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	default:
+		return nil, fmt.Errorf("unknown log encoding '%s', must be one of 'json' or 'console'", encoding)
+	}
+}
+
+func newWriteSyncer(path string, opts Options) (zapcore.WriteSyncer, error) {
+	switch path {
+	case "stdout":
+		return zapcore.Lock(os.Stdout), nil
+	case "stderr":
+		return zapcore.Lock(os.Stderr), nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log directory for '%s': %v", path, err)
+	}
+	return zapcore.AddSync(&lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    opts.MaxSizeMB,
+		MaxAge:     opts.MaxAgeDays,
+		MaxBackups: opts.MaxBackups,
+	}), nil
+}
+
+// DefaultLogFilePath returns the log file location within the user's state directory for the current OS
+func DefaultLogFilePath(applicationName string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	var stateDir string
+	switch runtime.GOOS {
+	case "darwin":
+		stateDir = filepath.Join(home, "Library", "Logs")
+	case "windows":
+		stateDir = os.Getenv("LocalAppData")
+		if stateDir == "" {
+			stateDir = filepath.Join(home, "AppData", "Local")
+		}
+	default:
+		stateDir = os.Getenv("XDG_STATE_HOME")
+		if stateDir == "" {
+			stateDir = filepath.Join(home, ".local", "state")
+		}
+	}
+	return filepath.Join(stateDir, applicationName, applicationName+".log"), nil
 }
@@ -0,0 +1,622 @@
+// Package mock_reddit serves a small offline stand-in for the reddit OAuth, listing and image endpoints used by
+// earthpullr. Point RedditAccessTokenUrl at {URL}/api/v1/access_token, RedditAuthorizeUrl at {URL}/api/v1/authorize
+// and RedditApiEndpoint at {URL} to use it.
+package mock_reddit
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	_ "golang.org/x/image/webp"
+	"hash/fnv"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultListingLimit = 25
+
+// MockUsername is the reddit user every authorization code login is granted for
+const MockUsername = "mock_user"
+
+// MockAuthor is the author of every fixture post
+const MockAuthor = "mock_photographer"
+
+// Faults injects failures into responses, every N counts requests across all endpoints and zero disables the fault
+type Faults struct {
+	RateLimitEvery     int
+	ServerErrorEvery   int
+	MalformedJSONEvery int
+	Latency            time.Duration
+	RetryAfterSecs     int
+	// Image faults only count image requests, LoginWallEvery serves an HTML page in place of the image and
+	// RemovedImageEvery redirects to a placeholder like imgur's for removed images
+	LoginWallEvery    int
+	RemovedImageEvery int
+}
+
+type Server struct {
+	FixtureDir string
+	Faults     Faults
+
+	requestCount  int64
+	imageCount    int64
+	tokenCount    int64
+	mu            sync.Mutex
+	posts         map[string][]Post
+	authCodes     map[string]authorization
+	refreshTokens map[string]string
+	listener      net.Listener
+	httpServer    *http.Server
+}
+
+// authorization is an approved authorization code awaiting exchange for a token
+type authorization struct {
+	redirectURI   string
+	codeChallenge string
+	scope         string
+}
+
+// Post is a single image post served within a subreddit listing
+type Post struct {
+	Name      string
+	Title     string
+	Subreddit string
+	FilePath  string
+	Width     int
+	Height    int
+}
+
+func NewServer(fixtureDir string, faults Faults) *Server {
+	return &Server{
+		FixtureDir:    fixtureDir,
+		Faults:        faults,
+		posts:         map[string][]Post{},
+		authCodes:     map[string]authorization{},
+		refreshTokens: map[string]string{},
+	}
+}
+
+// Start listens on listenAddress, use "127.0.0.1:0" for a random free port
+func (s *Server) Start(listenAddress string) error {
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on '%s': %v", listenAddress, err)
+	}
+	s.listener = listener
+	s.httpServer = &http.Server{Handler: s.Handler()}
+	go s.httpServer.Serve(listener)
+	return nil
+}
+
+func (s *Server) Close() error {
+	if s.httpServer == nil {
+		return nil
+	}
+	return s.httpServer.Close()
+}
+
+// URL is the base URL of the running server, usable as RedditApiEndpoint
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+func (s *Server) AccessTokenURL() string {
+	return s.URL() + "/api/v1/access_token"
+}
+
+// AuthorizeURL approves every request immediately, redirecting straight back to the redirect uri
+func (s *Server) AuthorizeURL() string {
+	return s.URL() + "/api/v1/authorize"
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/access_token", s.handleAccessToken)
+	mux.HandleFunc("/api/v1/authorize", s.handleAuthorize)
+	mux.HandleFunc("/api/v1/me", s.handleMe)
+	mux.HandleFunc("/r/", s.handleListing)
+	mux.HandleFunc("/user/", s.handleUserListing)
+	mux.HandleFunc("/by_id/", s.handleByID)
+	mux.HandleFunc("/images/", s.handleImage)
+	mux.HandleFunc("/removed.png", s.handleRemovedImage)
+	return s.withFaults(mux)
+}
+
+func (s *Server) withFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := int(atomic.AddInt64(&s.requestCount, 1))
+		if s.Faults.Latency > 0 {
+			select {
+			case <-time.After(s.Faults.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if every(count, s.Faults.RateLimitEvery) {
+			w.Header().Set("Retry-After", strconv.Itoa(s.Faults.RetryAfterSecs))
+			http.Error(w, `{"message": "Too Many Requests", "error": 429}`, http.StatusTooManyRequests)
+			return
+		}
+		if every(count, s.Faults.ServerErrorEvery) {
+			http.Error(w, `{"message": "Internal Server Error", "error": 500}`, http.StatusInternalServerError)
+			return
+		}
+		if every(count, s.Faults.MalformedJSONEvery) && !strings.HasPrefix(r.URL.Path, "/images/") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"kind": "Listing", "data": {"children": [`))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func every(count int, n int) bool {
+	return n > 0 && count%n == 0
+}
+
+func (s *Server) handleAccessToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if clientID, _, ok := r.BasicAuth(); !ok || clientID == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "Unauthorized", "error": 401})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid_request"})
+		return
+	}
+	scope := "*"
+	refreshToken := ""
+	switch r.PostForm.Get("grant_type") {
+	case "https://oauth.reddit.com/grants/installed_client", "client_credentials":
+	case "authorization_code":
+		var ok bool
+		scope, ok = s.exchangeAuthCode(r.PostForm)
+		if !ok {
+			// reddit reports grant errors with a 200 status
+			writeJSON(w, http.StatusOK, map[string]interface{}{"error": "invalid_grant"})
+			return
+		}
+		refreshToken = fmt.Sprintf("mock-refresh-%d", atomic.AddInt64(&s.tokenCount, 1))
+		s.mu.Lock()
+		s.refreshTokens[refreshToken] = scope
+		s.mu.Unlock()
+	case "refresh_token":
+		s.mu.Lock()
+		refreshScope, ok := s.refreshTokens[r.PostForm.Get("refresh_token")]
+		s.mu.Unlock()
+		if !ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"error": "invalid_grant"})
+			return
+		}
+		scope = refreshScope
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "unsupported_grant_type"})
+		return
+	}
+	count := atomic.AddInt64(&s.tokenCount, 1)
+	response := map[string]interface{}{
+		"access_token": fmt.Sprintf("mock-token-%d", count),
+		"token_type":   "bearer",
+		"device_id":    r.PostForm.Get("device_id"),
+		"expires_in":   3600,
+		"scope":        scope,
+	}
+	if refreshToken != "" {
+		response["refresh_token"] = refreshToken
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) exchangeAuthCode(form url.Values) (scope string, ok bool) {
+	s.mu.Lock()
+	auth, ok := s.authCodes[form.Get("code")]
+	delete(s.authCodes, form.Get("code"))
+	s.mu.Unlock()
+	if !ok || auth.redirectURI != form.Get("redirect_uri") {
+		return "", false
+	}
+	if auth.codeChallenge != "" {
+		sum := sha256.Sum256([]byte(form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+			return "", false
+		}
+	}
+	return auth.scope, true
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" || query.Get("client_id") == "" {
+		http.Error(w, "invalid client_id or redirect_uri", http.StatusBadRequest)
+		return
+	}
+	callbackQuery := url.Values{}
+	callbackQuery.Set("state", query.Get("state"))
+	if query.Get("response_type") != "code" {
+		callbackQuery.Set("error", "unsupported_response_type")
+	} else if query.Get("code_challenge") != "" && query.Get("code_challenge_method") != "S256" {
+		callbackQuery.Set("error", "invalid_request")
+	} else {
+		code := fmt.Sprintf("mock-code-%d", atomic.AddInt64(&s.tokenCount, 1))
+		s.mu.Lock()
+		s.authCodes[code] = authorization{
+			redirectURI:   query.Get("redirect_uri"),
+			codeChallenge: query.Get("code_challenge"),
+			scope:         query.Get("scope"),
+		}
+		s.mu.Unlock()
+		callbackQuery.Set("code", code)
+	}
+	redirectURI.RawQuery = callbackQuery.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "Unauthorized", "error": 401})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"name": MockUsername})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	return strings.HasPrefix(strings.ToLower(r.Header.Get("Authorization")), "bearer mock-token-")
+}
+
+// handleListing serves /r/{subreddit}/{sort} paginated with the limit and after query parameters, subreddits
+// combined with '+' are served one after another
+func (s *Server) handleListing(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "Unauthorized", "error": 401})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	var children []map[string]interface{}
+	for _, subreddit := range strings.Split(parts[1], "+") {
+		posts, err := s.Posts(subreddit)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": err.Error()})
+			return
+		}
+		for _, post := range posts {
+			children = append(children, s.listingChild(post))
+		}
+	}
+	s.writeListing(w, r, children)
+}
+
+// handleByID serves /by_id/{names}, posts are found in the subreddits already listed and the fixture subdirectories
+func (s *Server) handleByID(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "Unauthorized", "error": 401})
+		return
+	}
+	subreddits, err := s.knownSubreddits()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	postsByName := map[string]Post{}
+	for _, subreddit := range subreddits {
+		posts, err := s.Posts(subreddit)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": err.Error()})
+			return
+		}
+		for _, post := range posts {
+			postsByName[post.Name] = post
+		}
+	}
+	var children []map[string]interface{}
+	for _, name := range strings.Split(strings.TrimPrefix(r.URL.Path, "/by_id/"), ",") {
+		if post, ok := postsByName[name]; ok {
+			children = append(children, s.listingChild(post))
+		}
+	}
+	s.writeListing(w, r, children)
+}
+
+func (s *Server) knownSubreddits() ([]string, error) {
+	s.mu.Lock()
+	var subreddits []string
+	for subreddit := range s.posts {
+		subreddits = append(subreddits, subreddit)
+	}
+	s.mu.Unlock()
+	files, err := ioutil.ReadDir(s.FixtureDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture directory '%s': %v", s.FixtureDir, err)
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			subreddits = append(subreddits, strings.ToLower(file.Name()))
+		}
+	}
+	return subreddits, nil
+}
+
+// handleMultiredditListing serves /user/{username}/m/{multireddit}/{sort} from FixtureDir/{multireddit}
+func (s *Server) handleMultiredditListing(w http.ResponseWriter, r *http.Request, multireddit string) {
+	posts, err := s.Posts(multireddit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	var children []map[string]interface{}
+	for _, post := range posts {
+		children = append(children, s.listingChild(post))
+	}
+	s.writeListing(w, r, children)
+}
+
+// handleUserListing serves multireddits, /user/{username}/saved and /user/{username}/upvoted, the latter two are read from
+// FixtureDir/saved and FixtureDir/upvoted and also contain a comment and a text post like the real listings
+func (s *Server) handleUserListing(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"message": "Unauthorized", "error": 401})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 5 && parts[2] == "m" {
+		s.handleMultiredditListing(w, r, parts[3])
+		return
+	}
+	if len(parts) != 3 || (parts[2] != "saved" && parts[2] != "upvoted") {
+		http.NotFound(w, r)
+		return
+	}
+	if parts[1] != MockUsername {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{"message": "Forbidden", "error": 403})
+		return
+	}
+	posts, err := s.Posts(parts[2])
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	children := []map[string]interface{}{
+		{
+			"kind": "t1",
+			"data": map[string]interface{}{
+				"name":      "t1_" + postID(parts[2], "comment"),
+				"body":      "Saved comment",
+				"subreddit": "earthporn",
+			},
+		},
+		{
+			"kind": "t3",
+			"data": map[string]interface{}{
+				"name":      "t3_" + postID(parts[2], "self"),
+				"title":     "Text post",
+				"subreddit": "earthporn",
+				"is_self":   true,
+				"selftext":  "No images here",
+			},
+		},
+	}
+	for _, post := range posts {
+		children = append(children, s.listingChild(post))
+	}
+	s.writeListing(w, r, children)
+}
+
+func (s *Server) writeListing(w http.ResponseWriter, r *http.Request, children []map[string]interface{}) {
+	limit := defaultListingLimit
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		var err error
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"message": "invalid limit"})
+			return
+		}
+	}
+	start := 0
+	if after := r.URL.Query().Get("after"); after != "" {
+		start = len(children)
+		for i, child := range children {
+			if childName(child) == after {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := start + limit
+	if end > len(children) {
+		end = len(children)
+	}
+
+	page := []interface{}{}
+	for _, child := range children[start:end] {
+		page = append(page, child)
+	}
+	after := ""
+	if end < len(children) && end > start {
+		after = childName(children[end-1])
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"kind": "Listing",
+		"data": map[string]interface{}{
+			"after":    after,
+			"before":   nil,
+			"dist":     len(page),
+			"children": page,
+		},
+	})
+}
+
+func childName(child map[string]interface{}) string {
+	data, _ := child["data"].(map[string]interface{})
+	name, _ := data["name"].(string)
+	return name
+}
+
+func (s *Server) listingChild(post Post) map[string]interface{} {
+	return map[string]interface{}{
+		"kind": "t3",
+		"data": map[string]interface{}{
+			"name":      post.Name,
+			"id":        strings.TrimPrefix(post.Name, "t3_"),
+			"title":     post.Title,
+			"subreddit": post.Subreddit,
+			"author":    MockAuthor,
+			"domain":    "i.redd.it",
+			"permalink": "/r/" + post.Subreddit + "/comments/" + strings.TrimPrefix(post.Name, "t3_") + "/" + strings.ReplaceAll(strings.ToLower(post.Title), " ", "_") + "/",
+			"url":       s.URL() + "/images/" + post.Subreddit + "/" + filepath.Base(post.FilePath),
+			"post_hint": "image",
+			"preview": map[string]interface{}{
+				"images": []interface{}{
+					map[string]interface{}{
+						"source": map[string]interface{}{
+							"url":    s.URL() + "/images/" + post.Subreddit + "/" + filepath.Base(post.FilePath),
+							"width":  post.Width,
+							"height": post.Height,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/images/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	posts, err := s.Posts(parts[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	count := int(atomic.AddInt64(&s.imageCount, 1))
+	if every(count, s.Faults.LoginWallEvery) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<!DOCTYPE html><html><body><h1>Log in to view this image</h1></body></html>"))
+		return
+	}
+	if every(count, s.Faults.RemovedImageEvery) {
+		http.Redirect(w, r, "/removed.png", http.StatusFound)
+		return
+	}
+	for _, post := range posts {
+		if filepath.Base(post.FilePath) == parts[1] {
+			http.ServeFile(w, r, post.FilePath)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// handleRemovedImage serves a small grey placeholder like the one imgur redirects removed images to
+func (s *Server) handleRemovedImage(w http.ResponseWriter, r *http.Request) {
+	placeholder := image.NewGray(image.Rect(0, 0, 161, 81))
+	for i := range placeholder.Pix {
+		placeholder.Pix[i] = 0xd0
+	}
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, placeholder)
+}
+
+// Posts returns the posts for a subreddit, read from FixtureDir/{subreddit} if it exists otherwise from FixtureDir
+func (s *Server) Posts(subreddit string) ([]Post, error) {
+	subreddit = strings.ToLower(subreddit)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if posts, ok := s.posts[subreddit]; ok {
+		return posts, nil
+	}
+	dir := filepath.Join(s.FixtureDir, subreddit)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = s.FixtureDir
+	}
+	posts, err := readFixturePosts(dir, subreddit)
+	if err != nil {
+		return nil, err
+	}
+	s.posts[subreddit] = posts
+	return posts, nil
+}
+
+func readFixturePosts(dir string, subreddit string) ([]Post, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture directory '%s': %v", dir, err)
+	}
+	var posts []Post
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		fpath := filepath.Join(dir, file.Name())
+		config, err := decodeImageConfig(fpath)
+		if err != nil {
+			// Not an image, fixture directories may contain other files
+			continue
+		}
+		stem := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		posts = append(posts, Post{
+			Name:      "t3_" + postID(subreddit, stem),
+			Title:     strings.ReplaceAll(stem, "_", " "),
+			Subreddit: subreddit,
+			FilePath:  fpath,
+			Width:     config.Width,
+			Height:    config.Height,
+		})
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].FilePath < posts[j].FilePath
+	})
+	return posts, nil
+}
+
+func decodeImageConfig(fpath string) (image.Config, error) {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	return config, err
+}
+
+// postID derives a stable reddit style id from the subreddit and fixture file name
+func postID(subreddit string, stem string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(subreddit + "/" + stem))
+	return strconv.FormatUint(hash.Sum64(), 36)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	out, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
@@ -0,0 +1,43 @@
+// Package system_theme detects whether the operating system is using a dark theme.
+package system_theme
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// IsDark returns an error when the theme can't be determined, e.g. on desktops other than macOS, Windows and GNOME
+func IsDark() (bool, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		// AppleInterfaceStyle is only set while dark mode is on, reading it fails otherwise
+		out, err := exec.Command("defaults", "read", "-g", "AppleInterfaceStyle").Output()
+		if err != nil {
+			return false, nil
+		}
+		return strings.TrimSpace(string(out)) == "Dark", nil
+	case "windows":
+		out, err := exec.Command(
+			"reg", "query", `HKCU\Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`, "/v", "AppsUseLightTheme",
+		).Output()
+		if err != nil {
+			return false, fmt.Errorf("failed to read the windows theme: %v", err)
+		}
+		return strings.Contains(string(out), "0x0"), nil
+	default:
+		out, err := exec.Command("gsettings", "get", "org.gnome.desktop.interface", "color-scheme").Output()
+		if err == nil && strings.Contains(string(out), "prefer-dark") {
+			return true, nil
+		}
+		out, themeErr := exec.Command("gsettings", "get", "org.gnome.desktop.interface", "gtk-theme").Output()
+		if themeErr != nil {
+			if err != nil {
+				return false, fmt.Errorf("failed to read the desktop theme: %v", err)
+			}
+			return false, nil
+		}
+		return strings.Contains(strings.ToLower(string(out)), "dark"), nil
+	}
+}
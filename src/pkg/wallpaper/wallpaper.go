@@ -0,0 +1,24 @@
+// Package wallpaper sets the desktop background on macOS, Windows and the common Linux desktops.
+package wallpaper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Set uses the image at fpath as the background of every display
+func Set(fpath string) error {
+	fpath, err := filepath.Abs(fpath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(fpath); err != nil {
+		return fmt.Errorf("failed to set wallpaper: %v", err)
+	}
+	err = set(fpath)
+	if err != nil {
+		return fmt.Errorf("failed to set wallpaper to '%s': %v", fpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package wallpaper
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func set(fpath string) error {
+	if runtime.GOOS == "darwin" {
+		script := fmt.Sprintf(`tell application "System Events" to tell every desktop to set picture to %q`, fpath)
+		return run("osascript", "-e", script)
+	}
+	desktop := strings.ToLower(os.Getenv("XDG_CURRENT_DESKTOP"))
+	fileURI := (&url.URL{Scheme: "file", Path: fpath}).String()
+	switch {
+	case strings.Contains(desktop, "cinnamon"):
+		return run("gsettings", "set", "org.cinnamon.desktop.background", "picture-uri", fileURI)
+	case strings.Contains(desktop, "mate"):
+		return run("gsettings", "set", "org.mate.background", "picture-filename", fpath)
+	case strings.Contains(desktop, "kde"):
+		script := fmt.Sprintf(`desktops().forEach(d => { d.wallpaperPlugin = "org.kde.image"; d.currentConfigGroup = ["Wallpaper", "org.kde.image", "General"]; d.writeConfig("Image", %q) })`, fileURI)
+		err := run("qdbus", "org.kde.plasmashell", "/PlasmaShell", "org.kde.PlasmaShell.evaluateScript", script)
+		if err != nil {
+			// Plasma 6 only ships the Qt 6 build of qdbus
+			return run("qdbus6", "org.kde.plasmashell", "/PlasmaShell", "org.kde.PlasmaShell.evaluateScript", script)
+		}
+		return nil
+	case strings.Contains(desktop, "sway") || os.Getenv("SWAYSOCK") != "":
+		return run("swaymsg", "output", "*", "bg", fpath, "fill")
+	case strings.Contains(desktop, "gnome"), strings.Contains(desktop, "unity"), strings.Contains(desktop, "budgie"), strings.Contains(desktop, "pantheon"):
+		err := run("gsettings", "set", "org.gnome.desktop.background", "picture-uri", fileURI)
+		if err != nil {
+			return err
+		}
+		// Only GNOME 42 and later have a separate wallpaper for the dark theme
+		_ = run("gsettings", "set", "org.gnome.desktop.background", "picture-uri-dark", fileURI)
+		return nil
+	default:
+		// Window managers without a desktop usually have their background drawn by feh
+		return run("feh", "--bg-fill", fpath)
+	}
+}
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil && len(strings.TrimSpace(string(out))) > 0 {
+		return fmt.Errorf("%s failed: %v: %s", name, err, strings.TrimSpace(string(out)))
+	} else if err != nil {
+		return fmt.Errorf("%s failed: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package wallpaper
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	spiSetDeskWallpaper = 0x0014
+	spifUpdateIniFile   = 0x01
+	spifSendChange      = 0x02
+)
+
+var systemParametersInfo = syscall.NewLazyDLL("user32.dll").NewProc("SystemParametersInfoW")
+
+func set(fpath string) error {
+	path, err := syscall.UTF16PtrFromString(fpath)
+	if err != nil {
+		return err
+	}
+	ok, _, err := systemParametersInfo.Call(spiSetDeskWallpaper, 0, uintptr(unsafe.Pointer(path)), spifUpdateIniFile|spifSendChange)
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+	// The segment length field counts itself
+	maxSegmentLength = 0xFFFF
+)
+
+var jpegXMPHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+func isJPEG(data []byte) bool {
+	return len(data) >= 3 && data[0] == 0xFF && data[1] == markerSOI && data[2] == 0xFF
+}
+
+type jpegSegment struct {
+	marker byte
+	// raw is the whole segment including the marker and length
+	raw []byte
+}
+
+func (segment jpegSegment) isXMP() bool {
+	return segment.marker == markerAPP1 && bytes.HasPrefix(segment.raw[4:], jpegXMPHeader)
+}
+
+// splitJPEG returns the segments before the start of scan, and the remainder of the file which is left untouched
+func splitJPEG(data []byte) ([]jpegSegment, []byte, error) {
+	var segments []jpegSegment
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, nil, fmt.Errorf("malformed JPEG segment at offset %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == markerSOS {
+			return segments, data[pos:], nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, nil, fmt.Errorf("malformed JPEG segment length at offset %d", pos)
+		}
+		segments = append(segments, jpegSegment{marker: marker, raw: data[pos:end]})
+		pos = end
+	}
+}
+
+func embedJPEG(data []byte, packet []byte) ([]byte, error) {
+	segments, rest, err := splitJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	length := 2 + len(jpegXMPHeader) + len(packet)
+	if length > maxSegmentLength {
+		return nil, fmt.Errorf("XMP packet of %d bytes is too large for a JPEG segment", len(packet))
+	}
+	xmpSegment := make([]byte, 0, length+2)
+	xmpSegment = append(xmpSegment, 0xFF, markerAPP1, byte(length>>8), byte(length))
+	xmpSegment = append(xmpSegment, jpegXMPHeader...)
+	xmpSegment = append(xmpSegment, packet...)
+
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, markerSOI})
+	inserted := false
+	for _, segment := range segments {
+		if segment.isXMP() {
+			continue
+		}
+		// JFIF requires APP0 to come first, the XMP goes straight after it
+		if !inserted && segment.marker != markerAPP0 {
+			out.Write(xmpSegment)
+			inserted = true
+		}
+		out.Write(segment.raw)
+	}
+	if !inserted {
+		out.Write(xmpSegment)
+	}
+	out.Write(rest)
+	return out.Bytes(), nil
+}
+
+func readJPEG(data []byte) ([]byte, error) {
+	segments, _, err := splitJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		if segment.isXMP() {
+			return segment.raw[4+len(jpegXMPHeader):], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,111 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// The iTXt keyword XMP packets are stored under
+const pngXMPKeyword = "XML:com.adobe.xmp"
+
+func isPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngSignature)
+}
+
+type pngChunk struct {
+	chunkType string
+	data      []byte
+	// raw is the whole chunk including its length, type and CRC
+	raw []byte
+}
+
+func (chunk pngChunk) isXMP() bool {
+	return chunk.chunkType == "iTXt" && bytes.HasPrefix(chunk.data, []byte(pngXMPKeyword+"\x00"))
+}
+
+func splitPNG(data []byte) ([]pngChunk, error) {
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, fmt.Errorf("malformed PNG chunk at offset %d", pos)
+		}
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		end := pos + 12 + length
+		if end > len(data) {
+			return nil, fmt.Errorf("malformed PNG chunk length at offset %d", pos)
+		}
+		chunks = append(chunks, pngChunk{
+			chunkType: string(data[pos+4 : pos+8]),
+			data:      data[pos+8 : pos+8+length],
+			raw:       data[pos:end],
+		})
+		pos = end
+	}
+	return chunks, nil
+}
+
+func newPNGChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk[0:4], uint32(len(data)))
+	copy(chunk[4:8], chunkType)
+	chunk = append(chunk, data...)
+	crc := crc32.ChecksumIEEE(chunk[4:])
+	return append(chunk, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func embedPNG(data []byte, packet []byte) ([]byte, error) {
+	chunks, err := splitPNG(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].chunkType != "IHDR" {
+		return nil, fmt.Errorf("PNG does not start with an IHDR chunk")
+	}
+	// Uncompressed iTXt: keyword, null, compression flag, compression method, empty language and translated keyword
+	itxt := append([]byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), packet...)
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for i, chunk := range chunks {
+		if chunk.isXMP() {
+			continue
+		}
+		out.Write(chunk.raw)
+		if i == 0 {
+			out.Write(newPNGChunk("iTXt", itxt))
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func readPNG(data []byte) ([]byte, error) {
+	chunks, err := splitPNG(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunks {
+		if !chunk.isXMP() {
+			continue
+		}
+		// Skip the compression flag and method then the language tag and translated keyword
+		rest := chunk.data[len(pngXMPKeyword)+1:]
+		if len(rest) < 2 || rest[0] != 0 {
+			return nil, fmt.Errorf("compressed XMP iTXt chunks are not supported")
+		}
+		rest = rest[2:]
+		for i := 0; i < 2; i++ {
+			nul := bytes.IndexByte(rest, 0)
+			if nul < 0 {
+				return nil, fmt.Errorf("malformed XMP iTXt chunk")
+			}
+			rest = rest[nul+1:]
+		}
+		return rest, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,172 @@
+// Package xmp embeds attribution into JPEG and PNG files as an XMP packet and reads it back. The packet is inserted
+// as its own JPEG APP1 segment or PNG iTXt chunk so the image data itself is copied byte for byte.
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const earthpullrNamespace = "https://github.com/callumPearce/earthpullr/xmp/1.0/"
+
+var ErrNoAttribution = errors.New("image has no XMP attribution")
+
+// ErrUnsupportedFormat is returned for images other than JPEGs and PNGs
+var ErrUnsupportedFormat = errors.New("only JPEG and PNG images can hold XMP")
+
+type Attribution struct {
+	Title        string    `json:"title"`
+	Author       string    `json:"author"`
+	Subreddit    string    `json:"subreddit"`
+	Permalink    string    `json:"permalink"`
+	PostID       string    `json:"post_id"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// Embed replaces any XMP packet within the JPEG or PNG at fpath with one holding the attribution
+func Embed(fpath string, attribution Attribution) error {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+	packet := buildPacket(attribution)
+	var out []byte
+	switch {
+	case isJPEG(data):
+		out, err = embedJPEG(data, packet)
+	case isPNG(data):
+		out, err = embedPNG(data, packet)
+	default:
+		return fmt.Errorf("'%s': %w", fpath, ErrUnsupportedFormat)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to embed XMP into '%s': %v", fpath, err)
+	}
+	return writeFileAtomically(fpath, out)
+}
+
+// Read returns ErrNoAttribution when the image has no XMP packet written by earthpullr
+func Read(fpath string) (Attribution, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return Attribution{}, err
+	}
+	var packet []byte
+	switch {
+	case isJPEG(data):
+		packet, err = readJPEG(data)
+	case isPNG(data):
+		packet, err = readPNG(data)
+	default:
+		return Attribution{}, fmt.Errorf("'%s': %w", fpath, ErrUnsupportedFormat)
+	}
+	if err != nil {
+		return Attribution{}, fmt.Errorf("failed to read XMP from '%s': %v", fpath, err)
+	}
+	if packet == nil {
+		return Attribution{}, ErrNoAttribution
+	}
+	return parsePacket(packet)
+}
+
+func buildPacket(attribution Attribution) []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\" xmlns:earthpullr=\"" + earthpullrNamespace + "\">\n")
+	b.WriteString("   <dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">" + escape(attribution.Title) + "</rdf:li></rdf:Alt></dc:title>\n")
+	b.WriteString("   <dc:creator><rdf:Seq><rdf:li>" + escape(attribution.Author) + "</rdf:li></rdf:Seq></dc:creator>\n")
+	b.WriteString("   <dc:source>" + escape(attribution.Permalink) + "</dc:source>\n")
+	b.WriteString("   <earthpullr:Subreddit>" + escape(attribution.Subreddit) + "</earthpullr:Subreddit>\n")
+	b.WriteString("   <earthpullr:PostID>" + escape(attribution.PostID) + "</earthpullr:PostID>\n")
+	b.WriteString("   <earthpullr:DownloadedAt>" + attribution.DownloadedAt.UTC().Format(time.RFC3339) + "</earthpullr:DownloadedAt>\n")
+	b.WriteString("  </rdf:Description>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+func escape(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// Elements are matched by their local names, the namespaces written by buildPacket are the only ones expected
+type xmpMeta struct {
+	Descriptions []xmpDescription `xml:"RDF>Description"`
+}
+
+type xmpDescription struct {
+	Title        []string `xml:"title>Alt>li"`
+	Creator      []string `xml:"creator>Seq>li"`
+	Source       string   `xml:"source"`
+	Subreddit    string   `xml:"Subreddit"`
+	PostID       string   `xml:"PostID"`
+	DownloadedAt string   `xml:"DownloadedAt"`
+}
+
+func parsePacket(packet []byte) (Attribution, error) {
+	var meta xmpMeta
+	err := xml.Unmarshal(packet, &meta)
+	if err != nil {
+		return Attribution{}, fmt.Errorf("failed to parse XMP packet: %v", err)
+	}
+	for _, description := range meta.Descriptions {
+		if description.PostID == "" {
+			continue
+		}
+		attribution := Attribution{
+			Permalink: description.Source,
+			Subreddit: description.Subreddit,
+			PostID:    description.PostID,
+		}
+		if len(description.Title) > 0 {
+			attribution.Title = description.Title[0]
+		}
+		if len(description.Creator) > 0 {
+			attribution.Author = description.Creator[0]
+		}
+		if description.DownloadedAt != "" {
+			attribution.DownloadedAt, err = time.Parse(time.RFC3339, description.DownloadedAt)
+			if err != nil {
+				return attribution, fmt.Errorf("invalid download date '%s': %v", description.DownloadedAt, err)
+			}
+		}
+		return attribution, nil
+	}
+	return Attribution{}, ErrNoAttribution
+}
+
+func writeFileAtomically(fpath string, data []byte) error {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fpath)
+}
@@ -0,0 +1,164 @@
+package xmp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 36))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 36; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 7), 128, 255})
+		}
+	}
+	return img
+}
+
+func writeTestImage(t *testing.T, fname string, encode func(f *os.File, img image.Image) error) string {
+	t.Helper()
+	fpath := filepath.Join(t.TempDir(), fname)
+	f, err := os.Create(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = encode(f, testImage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fpath
+}
+
+var testFormats = []struct {
+	name   string
+	fname  string
+	encode func(f *os.File, img image.Image) error
+	// marker identifies an XMP packet in the file, so duplicates can be counted
+	marker []byte
+}{
+	{
+		name:   "jpeg",
+		fname:  "lake.jpg",
+		encode: func(f *os.File, img image.Image) error { return jpeg.Encode(f, img, nil) },
+		marker: jpegXMPHeader,
+	},
+	{
+		name:   "png",
+		fname:  "lake.png",
+		encode: func(f *os.File, img image.Image) error { return png.Encode(f, img) },
+		marker: []byte(pngXMPKeyword),
+	},
+}
+
+func TestEmbedAndRead(t *testing.T) {
+	first := Attribution{
+		Title:        "Lake Tekapo, New Zealand <& \"friends\"> [OC] [4000x3000]",
+		Author:       "someone",
+		Subreddit:    "EarthPorn",
+		Permalink:    "https://www.reddit.com/r/EarthPorn/comments/abc123/",
+		PostID:       "t3_abc123",
+		DownloadedAt: time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC),
+	}
+	second := first
+	second.Title = "Mt. Cook, New Zealand [OC] [4000x3000]"
+	second.PostID = "t3_def456"
+	for _, format := range testFormats {
+		t.Run(format.name, func(t *testing.T) {
+			fpath := writeTestImage(t, format.fname, format.encode)
+			if _, err := Read(fpath); !errors.Is(err, ErrNoAttribution) {
+				t.Fatalf("expected no attribution before embedding, got %v", err)
+			}
+
+			for _, attribution := range []Attribution{first, second} {
+				err := Embed(fpath, attribution)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := Read(fpath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != attribution {
+					t.Fatalf("read %+v, want %+v", got, attribution)
+				}
+			}
+
+			data, err := ioutil.ReadFile(fpath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count := bytes.Count(data, format.marker); count != 1 {
+				t.Fatalf("found %d XMP packets, want the first replaced by the second", count)
+			}
+			img, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("failed to decode the image after embedding: %v", err)
+			}
+			if img.Bounds() != testImage().Bounds() {
+				t.Fatalf("got bounds %v, want %v", img.Bounds(), testImage().Bounds())
+			}
+		})
+	}
+}
+
+func TestEmbedUnsupportedFormat(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "lake.gif")
+	err := ioutil.WriteFile(fpath, []byte("GIF89a"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Embed(fpath, Attribution{PostID: "t3_abc123"}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected an unsupported format, got %v", err)
+	}
+}
+
+func TestMalformedImages(t *testing.T) {
+	var validJPEG bytes.Buffer
+	err := jpeg.Encode(&validJPEG, testImage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iTXt := func(data string) []byte {
+		return append(append([]byte{}, pngSignature...), newPNGChunk("iTXt", []byte(data))...)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "jpeg truncated in a segment", data: validJPEG.Bytes()[:20]},
+		{name: "jpeg segment length too short", data: []byte{0xFF, markerSOI, 0xFF, markerAPP1, 0x00, 0x01, 0x00, 0x00}},
+		{name: "jpeg segment length past the end", data: []byte{0xFF, markerSOI, 0xFF, markerAPP0, 0x7F, 0xFF, 0x00, 0x00}},
+		{name: "jpeg of fill bytes", data: []byte{0xFF, markerSOI, 0xFF, 0xFF, 0xFF}},
+		{name: "jpeg without a marker", data: []byte{0xFF, markerSOI, 0xFF, 0x00, 0x00, 0x00, 0x00}},
+		{name: "png truncated chunk header", data: append(append([]byte{}, pngSignature...), 0x00, 0x00, 0x00)},
+		{name: "png chunk length past the end", data: append(append([]byte{}, pngSignature...), 0xFF, 0xFF, 0xFF, 0xFF, 'I', 'H', 'D', 'R', 0, 0, 0, 0)},
+		{name: "png XMP chunk without flags", data: iTXt(pngXMPKeyword + "\x00")},
+		{name: "png XMP chunk without language", data: iTXt(pngXMPKeyword + "\x00\x00\x00en")},
+		{name: "png compressed XMP chunk", data: iTXt(pngXMPKeyword + "\x00\x01\x00\x00\x00packet")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fpath := filepath.Join(t.TempDir(), "malformed")
+			err := ioutil.WriteFile(fpath, test.data, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Read(fpath); err == nil || errors.Is(err, ErrNoAttribution) {
+				t.Fatalf("expected reading to fail, got %v", err)
+			}
+			if err := Embed(fpath, Attribution{PostID: "t3_abc123"}); err == nil {
+				t.Fatal("expected embedding to fail")
+			}
+		})
+	}
+}